@@ -10,7 +10,7 @@ var FullCmd = &cobra.Command{
 	Use:   "full",
 	Short: "Run the full trails-completionist workflow",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := trailscompletionist.RunTrailsCompletionist(conf, debug); err != nil {
+		if err := trailscompletionist.RunTrailsCompletionist(cmd.Context(), conf, debug); err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -23,7 +23,11 @@ var GenerateChecklistCmd = &cobra.Command{
 		var foundGPXTrails []types.Trail
 		var err error
 		if trackFiles != "" {
-			foundGPXTrails, err = parser.ParseTrailsFromTrackFiles(trackFiles, true, nil)
+			osmData, err := loadOSMRegion()
+			if err != nil {
+				return err
+			}
+			foundGPXTrails, err = parser.ParseTrailsFromTrackFiles(cmd.Context(), trackFiles, true, osmData, parser.MatchOptionsFromConfig(conf))
 			if err != nil {
 				return err
 			}
@@ -32,10 +36,18 @@ var GenerateChecklistCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		combined, err := matcher.MatchTrails(foundGPXTrails, rawTrails)
+		matchOpts, err := matcher.OptionsFromConfig(conf)
+		if err != nil {
+			return err
+		}
+		combined, err := matcher.MatchTrails(foundGPXTrails, rawTrails, matchOpts)
+		if err != nil {
+			return err
+		}
+		genOpts, err := generator.OptionsFromConfig(conf)
 		if err != nil {
 			return err
 		}
-		return generator.GenerateChecklist(checklistFile, combined)
+		return generator.GenerateChecklist(checklistFile, combined, genOpts)
 	},
 }
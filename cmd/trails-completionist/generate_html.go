@@ -17,10 +17,21 @@ var GenerateHTMLCmd = &cobra.Command{
 		if checklistFile == "" || htmlFile == "" {
 			return fmt.Errorf("checklistFile and htmlFile must be specified via flag or env var")
 		}
+		genOpts, err := generator.OptionsFromConfig(conf)
+		if err != nil {
+			return err
+		}
+		// the OSM region is optional here, and only used to draw the trail map
+		if conf.OSMRegionFile != "" {
+			genOpts.OSMData, err = loadOSMRegion()
+			if err != nil {
+				return err
+			}
+		}
 		trails, err := parser.ParseTrailsFromChecklist(checklistFile)
 		if err != nil {
 			return err
 		}
-		return generator.GenerateHTMLOutput(htmlFile, trails)
+		return generator.GenerateHTMLOutput(htmlFile, trails, genOpts)
 	},
 }
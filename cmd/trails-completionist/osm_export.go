@@ -7,18 +7,68 @@ import (
 	"github.com/toozej/trails-completionist/pkg/osm"
 )
 
+var (
+	// osmExportVerify checks the existing binary cache instead of exporting
+	osmExportVerify bool
+	// osmExportInfo prints the existing binary cache header instead of exporting
+	osmExportInfo bool
+)
+
 var OsmExportCmd = &cobra.Command{
 	Use:   "osm-export",
-	Short: "Load OSM XML and export parsed map to binary file",
+	Short: "Load OSM XML or PBF and export parsed map to binary file",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		osmFile := conf.OSMRegionFile
 		if osmFile == "" {
 			return fmt.Errorf("osmRegionFile must be specified via flag or env var")
 		}
-		_, err := osm.LoadOSMData(osmFile, false)
+		filter, err := osm.ParseTagFilter(conf.OSMTagFilter)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case osmExportInfo:
+			header, err := osm.ReadCacheHeader(osm.CachePath(osmFile))
+			if err != nil {
+				return err
+			}
+			printCacheHeader(header)
+			return nil
+		case osmExportVerify:
+			header, err := osm.VerifyCache(osmFile, filter)
+			if header != nil {
+				printCacheHeader(header)
+			}
+			if err != nil {
+				return fmt.Errorf("binary cache %s is not usable: %w", osm.CachePath(osmFile), err)
+			}
+			fmt.Printf("Binary cache %s is valid.\n", osm.CachePath(osmFile))
+			return nil
+		}
+
+		_, err = osm.LoadOSMData(osmFile, conf.Rebuild, filter)
 		if err != nil {
 			return err
 		}
 		return nil
 	},
 }
+
+// printCacheHeader prints the details of a binary cache header
+func printCacheHeader(header *osm.CacheHeader) {
+	fmt.Printf("Format version: %d (current %d)\n", header.FormatVersion, osm.CacheFormatVersion)
+	fmt.Printf("Source file:    %s\n", header.SourceFile)
+	fmt.Printf("Source size:    %d bytes\n", header.SourceSize)
+	fmt.Printf("Source SHA-256: %s\n", header.SourceSHA256)
+	fmt.Printf("Tag filter:     %s\n", header.TagFilter)
+	fmt.Printf("Data SHA-256:   %s\n", header.DataSHA256)
+	fmt.Printf("Created at:     %s\n", header.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Contents:       %d nodes, %d ways, %d relations\n", header.Nodes, header.Ways, header.Relations)
+}
+
+func init() {
+	OsmExportCmd.Flags().BoolVar(&osmExportVerify, "verify", false, "Verify the existing binary cache against the OSM file and tag filter")
+	OsmExportCmd.Flags().BoolVar(&osmExportInfo, "info", false, "Print the header of the existing binary cache")
+	OsmExportCmd.MarkFlagsMutuallyExclusive("verify", "info")
+}
@@ -5,8 +5,12 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/pkg/osm"
 )
 
+// parseGPXExplain prints why each nearby trail was accepted or rejected as a match
+var parseGPXExplain bool
+
 var ParseGPXCmd = &cobra.Command{
 	Use:   "parse-gpx",
 	Short: "Parse trails out of GPX files",
@@ -15,7 +19,13 @@ var ParseGPXCmd = &cobra.Command{
 		if trackFiles == "" {
 			return fmt.Errorf("trackFiles must be specified via flag or env var")
 		}
-		trails, err := parser.ParseTrailsFromTrackFiles(trackFiles, true, nil)
+		osmData, err := loadOSMRegion()
+		if err != nil {
+			return err
+		}
+		opts := parser.MatchOptionsFromConfig(conf)
+		opts.Explain = parseGPXExplain
+		trails, err := parser.ParseTrailsFromTrackFiles(cmd.Context(), trackFiles, true, osmData, opts)
 		if err != nil {
 			return err
 		}
@@ -23,3 +33,19 @@ var ParseGPXCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// loadOSMRegion loads the configured OSM region file, which is needed to match GPX tracks to trails
+func loadOSMRegion() (*osm.OSMData, error) {
+	if conf.OSMRegionFile == "" {
+		return nil, fmt.Errorf("osmRegionFile must be specified via flag or env var to match GPX tracks to trails")
+	}
+	filter, err := osm.ParseTagFilter(conf.OSMTagFilter)
+	if err != nil {
+		return nil, err
+	}
+	return osm.LoadOSMData(conf.OSMRegionFile, conf.Rebuild, filter)
+}
+
+func init() {
+	ParseGPXCmd.Flags().BoolVar(&parseGPXExplain, "explain", false, "Print why each nearby trail was accepted or rejected as a match")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/toozej/trails-completionist/internal/matcher"
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+var ReportUnmatchedCmd = &cobra.Command{
+	Use:   "report-unmatched",
+	Short: "List trails found in GPX files which are missing from the raw input file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		trackFiles := conf.TrackFiles
+		inputFile := conf.InputFile
+		if trackFiles == "" || inputFile == "" {
+			return fmt.Errorf("trackFiles and inputFile must be specified via flag or env var")
+		}
+		osmData, err := loadOSMRegion()
+		if err != nil {
+			return err
+		}
+		foundGPXTrails, err := parser.ParseTrailsFromTrackFiles(cmd.Context(), trackFiles, true, osmData, parser.MatchOptionsFromConfig(conf))
+		if err != nil {
+			return err
+		}
+		rawTrails, err := parser.ParseTrailsFromRawInputFile(inputFile)
+		if err != nil {
+			return err
+		}
+		matchOpts, err := matcher.OptionsFromConfig(conf)
+		if err != nil {
+			return err
+		}
+		units, err := types.ParseUnitSystem(conf.Units)
+		if err != nil {
+			return err
+		}
+
+		unmatched := matcher.FindUnmatched(foundGPXTrails, rawTrails, matchOpts)
+		fmt.Printf("\n%d trails found in GPX files are missing from %s\n", len(unmatched), inputFile)
+		for _, u := range unmatched {
+			trail := u.Trail
+			fmt.Printf("\n%s\n", trail.Name)
+			if trail.Park != "" {
+				fmt.Printf("  Park:     %s\n", trail.Park)
+			}
+			fmt.Printf("  OSM ID:   %s/%d (%s)\n", trail.OSMType, trail.OSMId, trail.OSMURL())
+			fmt.Printf("  Length:   %s (%.1f%% covered)\n", trail.Length.Format(units), trail.PercentComplete)
+			// Only hikes completing the trail are recorded, so partly covered trails have none
+			if len(trail.Completions) > 0 {
+				sourceFiles := make([]string, len(trail.Completions))
+				for i, completion := range trail.Completions {
+					sourceFiles[i] = completion.SourceFile
+				}
+				fmt.Printf("  GPX:      %s\n", strings.Join(sourceFiles, ", "))
+			}
+			if len(u.Candidates) > 0 {
+				closest := make([]string, len(u.Candidates))
+				for i, candidate := range u.Candidates {
+					closest[i] = fmt.Sprintf("%s (%.2f)", candidate.Name, candidate.Score)
+				}
+				fmt.Printf("  Closest:  %s\n", strings.Join(closest, ", "))
+			}
+		}
+		return nil
+	},
+}
@@ -20,6 +20,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -65,8 +70,13 @@ func rootCmdPreRun(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Execute runs the root command. Interrupting the process (Ctrl-C) cancels the
+// command's context, so long-running work such as GPX processing stops early.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		log.Fatal(err.Error())
 	}
 }
@@ -90,12 +100,34 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Enable debug-level logging")
 
 	// optional flags for configuration, overrides env vars
+	rootCmd.PersistentFlags().StringVar(&conf.OSMTagFilter, "osmTagFilter", conf.OSMTagFilter, "OSM tags to keep when loading the OSM region file, e.g. \"highway=path|footway,leisure=park\" (\"*\" keeps everything)")
 	rootCmd.PersistentFlags().StringVarP(&conf.TrackFiles, "trackFiles", "t", conf.TrackFiles, "Track files directory")
-	rootCmd.PersistentFlags().StringVarP(&conf.OSMRegionFile, "osmRegionFile", "r", conf.OSMRegionFile, "OSM region file")
+	rootCmd.PersistentFlags().StringVarP(&conf.OSMRegionFile, "osmRegionFile", "r", conf.OSMRegionFile, "OSM region file (.osm XML or .osm.pbf)")
 	rootCmd.PersistentFlags().StringVarP(&conf.InputFile, "inputFile", "i", conf.InputFile, "Input file")
 	rootCmd.PersistentFlags().StringVarP(&conf.ChecklistFile, "checklistFile", "c", conf.ChecklistFile, "Checklist file")
 	rootCmd.PersistentFlags().StringVarP(&conf.HTMLFile, "htmlFile", "o", conf.HTMLFile, "HTML file")
 	rootCmd.PersistentFlags().BoolVarP(&conf.Serve, "serve", "s", conf.Serve, "Serve the generated HTML file")
+	rootCmd.PersistentFlags().StringVar(&conf.ServeAddr, "serveAddr", conf.ServeAddr, "Address to serve the HTML file on (\":3000\" serves it to the whole network)")
+	rootCmd.PersistentFlags().StringVar(&conf.AliasFile, "aliasFile", conf.AliasFile, "File of trail name aliases, one \"GPX name = listed name\" per line")
+	rootCmd.PersistentFlags().Float64Var(&conf.NameMatchThreshold, "nameMatchThreshold", conf.NameMatchThreshold, "Similarity from 0 to 1 a GPX trail name needs to match a listed trail name")
+	rootCmd.PersistentFlags().BoolVar(&conf.IncludeUnlisted, "includeUnlisted", conf.IncludeUnlisted, "Include trails found in GPX tracks but missing from the input file in an Unlisted section")
+	rootCmd.PersistentFlags().StringVar(&conf.Units, "units", conf.Units, "Units trail lengths are written in: imperial or metric")
+	rootCmd.PersistentFlags().StringVar(&conf.DateFormat, "dateFormat", conf.DateFormat, "Go time layout dates are written in, such as 01/02/2006 or 2006-01-02")
+	rootCmd.PersistentFlags().StringVar(&conf.MapTileDir, "mapTileDir", conf.MapTileDir, "Directory of {z}/{x}/{y}.png map tiles inside the HTML file's directory, drawn under the trail map")
+	rootCmd.PersistentFlags().StringVar(&conf.ParkOrder, "parkOrder", conf.ParkOrder, "Order parks are written in: name, completion or length")
+	rootCmd.PersistentFlags().StringVar(&conf.TrailOrder, "trailOrder", conf.TrailOrder, "Order trails are written in within each park: name or length")
+	rootCmd.PersistentFlags().StringVar(&conf.Region, "region", conf.Region, "Region the checklist and HTML file are titled with")
+	rootCmd.PersistentFlags().StringVar(&conf.TemplateDir, "templateDir", conf.TemplateDir, "Directory of templates, CSS and JS files used over the embedded defaults")
+	rootCmd.PersistentFlags().Float64Var(&conf.CompletionThreshold, "completionThreshold", conf.CompletionThreshold, "Percentage of a trail GPX tracks must cover to mark it completed")
+	rootCmd.PersistentFlags().Float64Var(&conf.MatchBBoxBuffer, "matchBBoxBuffer", conf.MatchBBoxBuffer, "Degrees added around each GPX track when searching for nearby trails")
+	rootCmd.PersistentFlags().Float64Var(&conf.MatchDistance, "matchDistance", conf.MatchDistance, "Meters a trail may be from a GPX track and still count as walked")
+	rootCmd.PersistentFlags().Float64Var(&conf.MatchSampleSpacing, "matchSampleSpacing", conf.MatchSampleSpacing, "Meters between the points checked along each trail")
+	rootCmd.PersistentFlags().Float64Var(&conf.MatchMinCoverage, "matchMinCoverage", conf.MatchMinCoverage, "Percentage of a trail a GPX track must walk to match it")
+	rootCmd.PersistentFlags().Float64Var(&conf.MatchMinCoveredLength, "matchMinCoveredLength", conf.MatchMinCoveredLength, "Meters of a trail a GPX track must walk to match it regardless of coverage")
+	rootCmd.PersistentFlags().IntVarP(&conf.Workers, "workers", "w", conf.Workers, "Number of GPX files processed at once (0 for one per CPU)")
+	rootCmd.PersistentFlags().StringVar(&conf.ResultsCacheDir, "resultsCacheDir", conf.ResultsCacheDir, "Directory to cache the results of processing each GPX file in")
+	rootCmd.PersistentFlags().BoolVar(&conf.Rebuild, "rebuild", conf.Rebuild, "Rebuild the OSM binary cache and reprocess every GPX file, ignoring cached results")
+	rootCmd.PersistentFlags().IntVar(&conf.MatchMaxResults, "matchMaxResults", conf.MatchMaxResults, "Most trails matched to a single GPX track (0 for no limit)")
 
 	// add sub-commands from separate files
 	rootCmd.AddCommand(
@@ -104,6 +136,7 @@ func init() {
 		ConvertCmd,
 		OsmExportCmd,
 		ParseGPXCmd,
+		ReportUnmatchedCmd,
 		GenerateChecklistCmd,
 		GenerateHTMLCmd,
 		ServeCmd,
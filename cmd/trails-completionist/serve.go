@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.com/toozej/trails-completionist/internal/generator"
 	trailscompletionist "github.com/toozej/trails-completionist/internal/trails-completionist"
 )
 
@@ -15,6 +16,18 @@ var ServeCmd = &cobra.Command{
 		if htmlFile == "" {
 			return fmt.Errorf("htmlFile must be specified via flag or env var")
 		}
-		return trailscompletionist.ServeHTMLFile(htmlFile)
+		genOpts, err := generator.OptionsFromConfig(conf)
+		if err != nil {
+			return err
+		}
+		// the OSM region is optional here, and only used to rebuild the trail map's geometries
+		// when trails are marked complete; without it the geometries already written are kept
+		if conf.OSMRegionFile != "" {
+			genOpts.OSMData, err = loadOSMRegion()
+			if err != nil {
+				return err
+			}
+		}
+		return trailscompletionist.ServeHTMLFile(conf.ServeAddr, conf.ChecklistFile, htmlFile, genOpts)
 	},
 }
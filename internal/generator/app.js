@@ -6,6 +6,8 @@
  * - Fuzzy text matching
  * - Specific column filtering
  * - Combining filters and free text search
+ * - A map tab, zoomed to a trail by clicking its row
+ * - Saving trails ticked complete or incomplete, when served by the serve command
  */
 
 document.addEventListener('DOMContentLoaded', () => {
@@ -23,8 +25,11 @@ document.addEventListener('DOMContentLoaded', () => {
         'park name': 'parkName',
         'trail type': 'trailType',
         'trail length': 'trailLength',
+        'progress': 'progress',
         'completed': 'completed',
-        'date completed': 'dateCompleted'
+        'date completed': 'dateCompleted',
+        'hikes': 'hikes',
+        'last hiked': 'lastHiked'
     };
 
     /**
@@ -81,6 +86,19 @@ document.addEventListener('DOMContentLoaded', () => {
         return true;
     };
 
+    /**
+     * Returns a row's cell in a column
+     *
+     * @param {HTMLTableRowElement} row - The row
+     * @param {string} column - The column's data-column attribute
+     * @returns {HTMLTableCellElement} The cell
+     */
+    const columnCell = (row, column) => {
+        const columnHeader = document.querySelector(`th[data-column="${column}"]`);
+        const columnIndex = Array.from(columnHeader.parentNode.children).indexOf(columnHeader);
+        return row.querySelector(`td:nth-child(${columnIndex + 1})`);
+    };
+
     /**
      * Performs the search and filtering on the table
      */
@@ -92,9 +110,7 @@ document.addEventListener('DOMContentLoaded', () => {
             // Check specific filters first
             let matchesFilters = true;
             for (const [column, value] of Object.entries(filters)) {
-                const columnHeader = document.querySelector(`th[data-column="${column}"]`);
-                const columnIndex = Array.from(columnHeader.parentNode.children).indexOf(columnHeader);
-                const cell = row.querySelector(`td:nth-child(${columnIndex + 1})`);
+                const cell = columnCell(row, column);
                 const cellText = cell.textContent.trim();
                 
                 // Special handling for 'completed' column
@@ -124,4 +140,100 @@ document.addEventListener('DOMContentLoaded', () => {
 
     // Add event listener for real-time search
     fuzzySearch.addEventListener('input', performSearch);
+
+    /**
+     * Returns today's date in the browser's time zone, as YYYY-MM-DD
+     *
+     * @returns {string} Today's date
+     */
+    const today = () => {
+        const now = new Date();
+        const pad = (number) => String(number).padStart(2, '0');
+        return `${now.getFullYear()}-${pad(now.getMonth() + 1)}-${pad(now.getDate())}`;
+    };
+
+    /**
+     * Saves a trail ticked complete (today) or incomplete to the checklist, through the API
+     * of the serve command, which also regenerates this page. The checkbox is reverted
+     * if saving fails.
+     *
+     * @param {HTMLTableRowElement} row - The trail's row
+     * @param {HTMLInputElement} checkbox - The trail's completed checkbox
+     */
+    const saveCompletion = async (row, checkbox) => {
+        checkbox.disabled = true;
+        try {
+            const response = await fetch('/api/trails/completion', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    name: row.dataset.trailName,
+                    park: row.dataset.trailPark,
+                    completed: checkbox.checked,
+                    date: checkbox.checked ? today() : ''
+                })
+            });
+            const result = await response.json().catch(() => ({}));
+            if (!response.ok) {
+                throw new Error(result.error || `${response.status} ${response.statusText}`);
+            }
+            columnCell(row, 'dateCompleted').textContent = result.date ? ` ${result.date} ` : ' - ';
+        } catch (error) {
+            checkbox.checked = !checkbox.checked;
+            alert(`Could not save ${row.dataset.trailName}: ${error.message}`);
+        } finally {
+            checkbox.disabled = false;
+        }
+    };
+
+    rows.forEach(row => {
+        const checkbox = columnCell(row, 'completed').querySelector('input[type="checkbox"]');
+        if (!checkbox || !row.dataset.trailName) return;
+        checkbox.addEventListener('change', () => saveCompletion(row, checkbox));
+    });
+
+    /**
+     * Map tab, drawing the trail geometries set by trails.geojson.js, written next to this page
+     */
+    const mapElement = document.getElementById('map');
+    const trailMap = mapElement && window.TrailMap ? new TrailMap(mapElement) : null;
+    let mapLoaded = false;
+
+    /**
+     * Shows a tab's panel, loading the map the first time its tab is shown
+     *
+     * @param {string} tabId - The ID of the panel to show
+     */
+    const showTab = (tabId) => {
+        document.querySelectorAll('.tab').forEach(tab => {
+            tab.classList.toggle('active', tab.dataset.tab === tabId);
+        });
+        document.querySelectorAll('.tab-panel').forEach(panel => {
+            panel.hidden = panel.id !== tabId;
+        });
+
+        if (tabId === 'mapView' && trailMap) {
+            if (!mapLoaded) {
+                trailMap.setData(window.trailsGeoJSON || { features: [] });
+                mapLoaded = true;
+            } else {
+                trailMap.render();
+            }
+        }
+    };
+
+    document.querySelectorAll('.tab').forEach(tab => {
+        tab.addEventListener('click', () => showTab(tab.dataset.tab));
+    });
+
+    // Clicking a trail's row zooms the map to it
+    rows.forEach(row => {
+        if (!row.dataset.trailId) return;
+        row.classList.add('on-map');
+        row.addEventListener('click', (event) => {
+            if (event.target.closest('a, input')) return;
+            showTab('mapView');
+            trailMap.zoomTo(row.dataset.trailId);
+        });
+    });
 });
\ No newline at end of file
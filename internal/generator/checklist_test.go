@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+var update = flag.Bool("update", false, "update the golden checklist files in testdata")
+
+// regenerateChecklist parses a checklist and writes it back out to a new file, returning its contents
+func regenerateChecklist(t *testing.T, input string) []byte {
+	t.Helper()
+
+	trails, err := parser.ParseTrailsFromChecklist(input)
+	if err != nil {
+		t.Fatalf("ParseTrailsFromChecklist(%s) returned error: %v", input, err)
+	}
+
+	output := filepath.Join(t.TempDir(), "checklist.md")
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat}
+	if err := GenerateChecklist(output, trails, opts); err != nil {
+		t.Fatalf("GenerateChecklist returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(output) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestChecklistRoundTrip(t *testing.T) {
+	input := filepath.Join("testdata", "checklist_v2.md")
+	got := regenerateChecklist(t, input)
+
+	if *update {
+		if err := os.WriteFile(input, got, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("regenerated checklist differs from %s:\n%s", input, got)
+	}
+}
+
+func TestChecklistUpgrade(t *testing.T) {
+	golden := filepath.Join("testdata", "checklist_v1.golden.md")
+	got := regenerateChecklist(t, filepath.Join("testdata", "checklist_v1.md"))
+
+	if *update {
+		if err := os.WriteFile(golden, got, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("upgraded checklist differs from %s:\n%s", golden, got)
+	}
+
+	// The upgraded checklist is itself stable
+	if again := regenerateChecklist(t, golden); !bytes.Equal(again, want) {
+		t.Errorf("regenerated upgraded checklist differs from %s:\n%s", golden, again)
+	}
+}
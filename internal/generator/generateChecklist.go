@@ -1,11 +1,11 @@
 package generator
 
 import (
-	"embed"
 	"fmt"
-	"html/template"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"text/template"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/toozej/trails-completionist/internal/types"
@@ -13,57 +13,113 @@ import (
 
 // generate easy-to-use Markdown-based checklist of trails given parsed list of trails from raw input text file
 
-// format:
+// format (the full grammar is documented with parser.ChecklistVersion):
+// <!-- trails-completionist checklist v2 -->
 // # PDX Trails Completionist
+// (progress stats, see buildStats)
 // ## Park 1
 // - Trail A
-//     - Trail
-//     - 7.3 miles
-//     - Completed 10/10/2023
+//     - type: Trail
+//     - length: 7.3 miles (or 11.7 km when writing metric units)
+//     - url: https://example.com/trail-a
+//     - osm: way/123456
+//     - covered: 95.2%
+//     - remaining: 2.1-2.4 mi
+//     - completed: 10/10/2023
+//     - hiked: 3 times, last on 10/10/2023
+//         - 08/15/2023
+//         - 09/01/2023 tracks/2023-09-01.gpx
+//         - 10/10/2023 tracks/2023-10-10.gpx
+//     - tags: loop, dogs
+//     - note: Bring water
 // - Trail B
-//     - Connector
-//     - 0.2 miles
-//     - Completed 05/01/2022
-// - Trail C
-//     - Connector
-//     - 0.4 miles
+//     - type: Connector
+//     - length: 0.2 miles
+//     - completed: yes
 // ## Park 2
-
-// Create a Markdown file
-func createMDOutputFile(filename string) (*os.File, error) {
-	fp, err := os.Create(filename) // #nosec G304
+// ## Unlisted
+// - Trail C
+//     - type: Trail
+//     - length: 1.1 miles
+//     - park: Park 1
+//     - osm: way/234567
+
+// Parse the Markdown template, and any other *.md.tmpl files it uses
+func parseMDTemplate(tmpl fs.FS, opts Options) (*template.Template, error) {
+	t, err := template.New(checklistTemplate).Funcs(templateFuncs(opts)).ParseFS(tmpl, "*.md.tmpl")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error parsing checklist template: %w", err)
 	}
-
-	return fp, nil
+	if t.Lookup(checklistTemplate) == nil {
+		return nil, fmt.Errorf("error parsing checklist template: %s not found", checklistTemplate)
+	}
+	return t, nil
 }
 
-func executeMDTemplate(fp *os.File, tmpl *embed.FS, trailsByPark map[string][]types.Trail) error {
-	// Create and execute the Markdown template
-	t := template.Must(template.ParseFS(tmpl, "*.md.tmpl"))
+func executeMDTemplate(fp *os.File, t *template.Template, trailsByPark TemplateData) error {
+	// Execute the Markdown template
 	err := t.Execute(fp, trailsByPark)
 	if err != nil {
-		return err
+		return fmt.Errorf("error in checklist template: %w", err)
 	}
-
-	defer fp.Close()
 	return nil
 }
 
-func GenerateChecklist(filename string, trails []types.Trail) error {
-	trailsByPark, err := organizeTrails(trails)
+// WriteChecklist writes the checklist of trails to filename as they are, writing to a
+// temporary file first so the checklist is never left half written. Unlike GenerateChecklist,
+// it doesn't merge with the existing checklist, so trails can be marked incomplete.
+func WriteChecklist(filename string, trails []types.Trail, opts Options) error {
+	trailsByPark, err := organizeTrails(trails, opts)
 	if err != nil {
 		return err
 	}
 
-	f, err := createMDOutputFile(filename)
+	t, err := parseMDTemplate(templateFS(opts.TemplateDir), opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating checklist: %w", err)
+	}
+	tmpPath := file.Name()
+
+	// keep the permissions of the checklist being replaced
+	if info, statErr := os.Stat(filename); statErr == nil {
+		err = file.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = executeMDTemplate(file, t, trailsByPark)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filename); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error replacing checklist: %w", err)
+	}
+	return nil
+}
+
+// GenerateChecklist writes the checklist of trails to filename. If the checklist already
+// exists, the trails are merged with it first, so hand-recorded hikes, URLs and notes
+// are kept, see mergeChecklistTrails.
+func GenerateChecklist(filename string, trails []types.Trail, opts Options) error {
+	existing, err := readExistingChecklist(filename)
 	if err != nil {
 		return err
 	}
+	trails = mergeChecklistTrails(existing, trails)
 
-	// List all files in the embedded file system
-	err = fs.WalkDir(&Templates, ".", func(path string, d fs.DirEntry, err error) error {
+	// List all files in the template file system
+	tmpl := templateFS(opts.TemplateDir)
+	err = fs.WalkDir(tmpl, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			fmt.Printf("Error accessing path %s: %v\n", path, err)
 			return nil
@@ -72,7 +128,7 @@ func GenerateChecklist(filename string, trails []types.Trail) error {
 		// Check if it's a file
 		if !d.IsDir() {
 			// Read the file content
-			fileContent, err := Templates.ReadFile(path)
+			fileContent, err := fs.ReadFile(tmpl, path)
 			if err != nil {
 				fmt.Printf("Error reading file %s: %v\n", path, err)
 				return nil
@@ -89,10 +145,10 @@ func GenerateChecklist(filename string, trails []types.Trail) error {
 		return nil
 	})
 	if err != nil {
-		fmt.Println("Error walking through the embedded file system:", err)
+		fmt.Println("Error walking through the template file system:", err)
 	}
 
-	err = executeMDTemplate(f, &Templates, trailsByPark)
+	err = WriteChecklist(filename, trails, opts)
 	if err != nil {
 		return err
 	} else {
@@ -1,40 +1,61 @@
 package generator
 
 import (
-	"embed"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/toozej/trails-completionist/internal/types"
 )
 
-// Create a map to organize trails by park
-func organizeTrails(trails []types.Trail) (map[string][]types.Trail, error) {
-	trailsByPark := make(map[string][]types.Trail)
+// Organize trails by park, keeping unlisted trails separate, and sort both in the
+// configured order so the same trails are always written the same way
+func organizeTrails(trails []types.Trail, opts Options) (TemplateData, error) {
+	data := TemplateData{Region: opts.Region, Generated: time.Now()}
+	if data.Region == "" {
+		data.Region = defaultRegion
+	}
+	parkIndex := make(map[string]int)
 	for _, trail := range trails {
-		trailsByPark[trail.Park] = append(trailsByPark[trail.Park], trail)
+		if trail.Unlisted {
+			data.Unlisted = append(data.Unlisted, trail)
+			continue
+		}
+		i, ok := parkIndex[trail.Park]
+		if !ok {
+			i = len(data.Parks)
+			parkIndex[trail.Park] = i
+			data.Parks = append(data.Parks, ParkTrails{Name: trail.Park, Stats: ParkStats{Park: trail.Park}})
+		}
+		data.Parks[i].Trails = append(data.Parks[i].Trails, trail)
+		data.Parks[i].Stats.add(trail)
 	}
 
-	return trailsByPark, nil
-}
-
-// Create an HTML file
-func createHTMLOutputFile(filename string) (*os.File, error) {
-	fp, err := os.Create(filename) // #nosec G304
-	if err != nil {
-		return nil, err
+	for _, park := range data.Parks {
+		sortTrails(park.Trails, opts.TrailOrder)
 	}
+	sortTrails(data.Unlisted, opts.TrailOrder)
+	sortParks(data.Parks, opts.ParkOrder)
+	data.Stats = buildStats(data)
 
-	return fp, nil
+	return data, nil
 }
 
-// Copy static files to output directory
-func copyStaticFiles(tmpl *embed.FS, outputDir string) error {
-	files := []string{"app.js", "styles.css"}
+// Copy static files, the CSS and JS files among the templates, to output directory
+func copyStaticFiles(tmpl fs.FS, outputDir string) error {
+	var files []string
+	for _, pattern := range []string{"*.js", "*.css"} {
+		matches, err := fs.Glob(tmpl, pattern)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
 	for _, file := range files {
-		data, err := tmpl.ReadFile(file)
+		data, err := fs.ReadFile(tmpl, file)
 		if err != nil {
 			return err
 		}
@@ -48,40 +69,97 @@ func copyStaticFiles(tmpl *embed.FS, outputDir string) error {
 	return nil
 }
 
-// Create and execute the template
-func executeHTMLTemplate(fp *os.File, tmpl *embed.FS, trailsByPark map[string][]types.Trail) error {
-	t := template.Must(template.ParseFS(tmpl, "*.html.tmpl"))
+// Parse the HTML template, and any other *.html.tmpl files it uses
+func parseHTMLTemplate(tmpl fs.FS, opts Options) (*template.Template, error) {
+	t, err := template.New(htmlTemplate).Funcs(templateFuncs(opts)).ParseFS(tmpl, "*.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML template: %w", err)
+	}
+	if t.Lookup(htmlTemplate) == nil {
+		return nil, fmt.Errorf("error parsing HTML template: %s not found", htmlTemplate)
+	}
+	return t, nil
+}
+
+// Execute the template
+func executeHTMLTemplate(fp *os.File, t *template.Template, trailsByPark TemplateData) error {
 	err := t.Execute(fp, trailsByPark)
 	if err != nil {
+		return fmt.Errorf("error in HTML template: %w", err)
+	}
+	return nil
+}
+
+// writeHTMLOutputFile writes the HTML file from the template, writing to a temporary file
+// first so the page being served is never left empty or half written
+func writeHTMLOutputFile(filename string, t *template.Template, trailsByPark TemplateData) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating HTML output file: %w", err)
+	}
+	tmpPath := file.Name()
+
+	// keep the permissions of the HTML file being replaced, or those it would be created with
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(filename); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	err = file.Chmod(mode)
+	if err == nil {
+		err = executeHTMLTemplate(file, t, trailsByPark)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
 		return err
 	}
 
-	defer fp.Close()
+	if err := os.Rename(tmpPath, filename); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error replacing HTML output file: %w", err)
+	}
 	return nil
 }
 
 // Create HTML page using template
-func GenerateHTMLOutput(filename string, trails []types.Trail) error {
-	trailsByPark, err := organizeTrails(trails)
+func GenerateHTMLOutput(filename string, trails []types.Trail, opts Options) error {
+	trailsByPark, err := organizeTrails(trails, opts)
 	if err != nil {
 		return err
 	}
 
-	file, err := createHTMLOutputFile(filename)
+	outputDir := filepath.Dir(filename)
+	trailsByPark.MapTiles, err = mapTilesURL(outputDir, opts.MapTileDir)
+	if err != nil {
+		return err
+	}
+
+	tmpl := templateFS(opts.TemplateDir)
+	t, err := parseHTMLTemplate(tmpl, opts)
 	if err != nil {
 		return err
 	}
 
 	// copy CSS and JS files to output directory
-	outputDir := filepath.Dir(filename)
-	err = copyStaticFiles(&Templates, outputDir)
+	err = copyStaticFiles(tmpl, outputDir)
 	if err != nil {
 		return err
 	} else {
 		fmt.Println("Static files copied successfully.")
 	}
 
-	err = executeHTMLTemplate(file, &Templates, trailsByPark)
+	// write the trail geometries for the map next to them
+	err = writeGeoJSON(outputDir, trails, opts)
+	if err != nil {
+		return err
+	} else {
+		fmt.Println("Trail map data written successfully.")
+	}
+
+	// the HTML file is only replaced once everything it loads is written
+	err = writeHTMLOutputFile(filename, t, trailsByPark)
 	if err != nil {
 		return err
 	} else {
@@ -0,0 +1,201 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// geoJSONFile is the file of trail geometries drawn on the HTML page's map, written next to the HTML file
+const geoJSONFile = "trails.geojson"
+
+// geoJSONScriptFile is the script setting geoJSONScriptVar to the trail geometries, which the HTML
+// page loads so its map works when the page is opened directly rather than served
+const (
+	geoJSONScriptFile = "trails.geojson.js"
+	geoJSONScriptVar  = "window.trailsGeoJSON"
+)
+
+// GeoJSON structures, see RFC 7946
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Properties featureProperties `json:"properties"`
+	Geometry   featureGeometry   `json:"geometry"`
+}
+
+type featureProperties struct {
+	Name            string  `json:"name"`
+	Park            string  `json:"park"`
+	Length          string  `json:"length"`
+	Status          string  `json:"status"` // completed, started or not-started, see trailStatus
+	PercentComplete float64 `json:"percentComplete"`
+}
+
+type featureGeometry struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// mapID returns the ID of a trail's feature on the map, or "" if it wasn't found in OSM
+func mapID(trail types.Trail) string {
+	if trail.OSMId == 0 || trail.OSMType == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", trail.OSMType, trail.OSMId)
+}
+
+// trailStatus returns how far along a trail is, which the map colors it by
+func trailStatus(trail types.Trail) string {
+	switch {
+	case trail.Completed:
+		return "completed"
+	case trail.PercentComplete > 0 || len(trail.Completions) > 0:
+		return "started"
+	default:
+		return "not-started"
+	}
+}
+
+// buildGeoJSON returns the geometries of the trails found in the OSM data, as OSM ways or
+// relations matched to GPX tracks. Trails sharing an OSM ID are drawn once.
+func buildGeoJSON(trails []types.Trail, opts Options) featureCollection {
+	collection := featureCollection{Type: "FeatureCollection", Features: []feature{}}
+	if opts.OSMData == nil {
+		return collection
+	}
+
+	seen := make(map[string]bool)
+	for _, trail := range trails {
+		id := mapID(trail)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		geometry := opts.OSMData.TrailGeometry(trail.OSMType, trail.OSMId)
+		if len(geometry) == 0 {
+			continue
+		}
+		// Six decimal places is about 10cm, and keeps the file small
+		for _, line := range geometry {
+			for i, point := range line {
+				line[i] = [2]float64{math.Round(point[0]*1e6) / 1e6, math.Round(point[1]*1e6) / 1e6}
+			}
+		}
+
+		collection.Features = append(collection.Features, feature{
+			Type:       "Feature",
+			ID:         id,
+			Properties: trailProperties(trail, opts),
+			Geometry:   featureGeometry{Type: "MultiLineString", Coordinates: geometry},
+		})
+	}
+	return collection
+}
+
+// trailProperties returns the properties of a trail's feature on the map
+func trailProperties(trail types.Trail, opts Options) featureProperties {
+	return featureProperties{
+		Name:            trail.Name,
+		Park:            trail.Park,
+		Length:          trail.Length.Format(opts.Units),
+		Status:          trailStatus(trail),
+		PercentComplete: trail.PercentComplete,
+	}
+}
+
+// updateGeoJSON updates the properties of the features in a previously written collection
+// from the trails drawn as them, keeping their geometries
+func updateGeoJSON(collection featureCollection, trails []types.Trail, opts Options) featureCollection {
+	byID := make(map[string]types.Trail)
+	for _, trail := range trails {
+		if id := mapID(trail); id != "" {
+			if _, exists := byID[id]; !exists {
+				byID[id] = trail
+			}
+		}
+	}
+	for i, feature := range collection.Features {
+		if trail, ok := byID[feature.ID]; ok {
+			collection.Features[i].Properties = trailProperties(trail, opts)
+		}
+	}
+	return collection
+}
+
+// writeGeoJSON writes the GeoJSON file of trail geometries, and the script the HTML page loads
+// them from, to the output directory. Without
+// OSM data the geometries can't be rebuilt, as when serve regenerates the HTML page without
+// an OSM region file, so a previously written file keeps its geometries and only has the
+// trails' completion updated.
+func writeGeoJSON(outputDir string, trails []types.Trail, opts Options) error {
+	outputPath := filepath.Join(outputDir, geoJSONFile)
+	collection := buildGeoJSON(trails, opts)
+	if opts.OSMData == nil {
+		data, err := os.ReadFile(outputPath) // #nosec G304
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error reading trail geometries: %w", err)
+		}
+		if err == nil {
+			var existing featureCollection
+			if err := json.Unmarshal(data, &existing); err != nil {
+				return fmt.Errorf("error reading trail geometries: %w", err)
+			}
+			collection = updateGeoJSON(existing, trails, opts)
+		}
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return fmt.Errorf("error encoding trail geometries: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath, data, 0600); err != nil { // #nosec G304
+		return fmt.Errorf("error writing trail geometries: %w", err)
+	}
+
+	// the GeoJSON is also a JavaScript object literal, so the script only has to assign it
+	script := geoJSONScriptVar + " = " + string(data) + ";"
+	if err := os.WriteFile(filepath.Join(outputDir, geoJSONScriptFile), []byte(script), 0600); err != nil { // #nosec G304
+		return fmt.Errorf("error writing trail geometries: %w", err)
+	}
+	return nil
+}
+
+// mapTilesURL returns the URL template of the local map tile directory, relative to the HTML
+// file's directory it must be inside of to be served with the page, or "" if there is none
+func mapTilesURL(outputDir, tileDir string) (string, error) {
+	if tileDir == "" {
+		return "", nil
+	}
+	if info, err := os.Stat(tileDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("map tile directory %s not found", tileDir)
+	}
+
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", err
+	}
+	absTileDir, err := filepath.Abs(tileDir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absOutputDir, absTileDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("map tile directory %s must be inside %s, the HTML file's directory, to be served with it", tileDir, outputDir)
+	}
+	return filepath.ToSlash(rel) + "/{z}/{x}/{y}.png", nil
+}
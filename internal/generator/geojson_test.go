@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/types"
+	"github.com/toozej/trails-completionist/pkg/osm"
+)
+
+func TestBuildGeoJSON(t *testing.T) {
+	osmData := &osm.OSMData{
+		Nodes: map[int64]osm.OSMNode{
+			1: {ID: 1, Lat: 45.5, Lon: -122.7}, 2: {ID: 2, Lat: 45.51, Lon: -122.71},
+		},
+		Ways: map[int64]osm.OSMWay{
+			10: {ID: 10, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "path", "name": "Wildwood Trail"}},
+		},
+	}
+	trails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", OSMType: "way", OSMId: 10, Completed: true},
+		{Name: "Unmapped Trail", Park: "Forest Park"},
+		{Name: "Missing Trail", OSMType: "way", OSMId: 99},
+	}
+
+	collection := buildGeoJSON(trails, Options{Units: types.Imperial, OSMData: osmData})
+	if len(collection.Features) != 1 {
+		t.Fatalf("expected 1 feature, got %+v", collection.Features)
+	}
+	feature := collection.Features[0]
+	if feature.ID != "way/10" || feature.Properties.Status != "completed" || len(feature.Geometry.Coordinates) != 1 {
+		t.Errorf("unexpected feature %+v", feature)
+	}
+
+	if collection := buildGeoJSON(trails, Options{}); len(collection.Features) != 0 {
+		t.Errorf("expected no features without OSM data, got %+v", collection.Features)
+	}
+}
+
+func TestWriteGeoJSON_WithoutOSMData(t *testing.T) {
+	outputDir := t.TempDir()
+	osmData := &osm.OSMData{
+		Nodes: map[int64]osm.OSMNode{
+			1: {ID: 1, Lat: 45.5, Lon: -122.7}, 2: {ID: 2, Lat: 45.51, Lon: -122.71},
+		},
+		Ways: map[int64]osm.OSMWay{
+			10: {ID: 10, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "path", "name": "Wildwood Trail"}},
+		},
+	}
+	trails := []types.Trail{{Name: "Wildwood Trail", Park: "Forest Park", OSMType: "way", OSMId: 10}}
+
+	// Without OSM data and no earlier file, an empty collection is written for the page to load
+	if err := writeGeoJSON(outputDir, trails, Options{Units: types.Imperial}); err != nil {
+		t.Fatalf("writeGeoJSON returned error: %v", err)
+	}
+	if collection := readGeoJSON(t, outputDir); len(collection.Features) != 0 {
+		t.Errorf("expected no features, got %+v", collection.Features)
+	}
+
+	if err := writeGeoJSON(outputDir, trails, Options{Units: types.Imperial, OSMData: osmData}); err != nil {
+		t.Fatalf("writeGeoJSON returned error: %v", err)
+	}
+
+	// Regenerating without OSM data, as serve does, keeps the geometries and updates completion
+	trails[0].Completed = true
+	if err := writeGeoJSON(outputDir, trails, Options{Units: types.Imperial}); err != nil {
+		t.Fatalf("writeGeoJSON returned error: %v", err)
+	}
+	collection := readGeoJSON(t, outputDir)
+	if len(collection.Features) != 1 || len(collection.Features[0].Geometry.Coordinates) != 1 {
+		t.Fatalf("expected the trail's geometry to be kept, got %+v", collection.Features)
+	}
+	if status := collection.Features[0].Properties.Status; status != "completed" {
+		t.Errorf("expected the trail's status to be updated, got %q", status)
+	}
+
+	// The page loads the same geometries from a script, so it works when opened directly
+	data, err := os.ReadFile(filepath.Join(outputDir, geoJSONFile)) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := os.ReadFile(filepath.Join(outputDir, geoJSONScriptFile)) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "window.trailsGeoJSON = " + string(data) + ";"; string(script) != want {
+		t.Errorf("%s = %q, want %q", geoJSONScriptFile, script, want)
+	}
+}
+
+// readGeoJSON reads the GeoJSON file written to the output directory
+func readGeoJSON(t *testing.T, outputDir string) featureCollection {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(outputDir, geoJSONFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var collection featureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		t.Fatal(err)
+	}
+	return collection
+}
+
+func TestMapTilesURL(t *testing.T) {
+	outputDir := t.TempDir()
+	tileDir := filepath.Join(outputDir, "tiles")
+	if err := os.Mkdir(tileDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := mapTilesURL(outputDir, tileDir); err != nil || got != "tiles/{z}/{x}/{y}.png" {
+		t.Errorf("mapTilesURL = %q, %v, want tiles/{z}/{x}/{y}.png", got, err)
+	}
+	if _, err := mapTilesURL(outputDir, t.TempDir()); err == nil {
+		t.Error("expected an error for a tile directory outside the HTML file's directory")
+	}
+	if got, err := mapTilesURL(outputDir, ""); err != nil || got != "" {
+		t.Errorf("mapTilesURL without a tile directory = %q, %v, want none", got, err)
+	}
+}
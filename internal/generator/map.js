@@ -0,0 +1,309 @@
+/**
+ * map.js - Offline trail map for trails-completionist HTML pages
+ *
+ * A small, dependency-free map which draws GeoJSON LineString and
+ * MultiLineString features as SVG, in the Web Mercator projection, over
+ * optional raster tiles in the {z}/{x}/{y}.png layout. It supports:
+ * - Dragging to pan, and the mouse wheel or +/- buttons to zoom
+ * - Zooming to a single feature by its ID
+ * - Working offline, without a map service, and from a page opened from disk
+ *
+ * It stands in for a vendored map library such as Leaflet, drawing only what
+ * the trails page needs; a library can replace it through --templateDir.
+ */
+
+(() => {
+    const TILE_SIZE = 256;
+    const MIN_ZOOM = 1;
+    const MAX_ZOOM = 19;
+    const SVG_NS = 'http://www.w3.org/2000/svg';
+
+    /**
+     * Projects a [lon, lat] point to world pixel coordinates at zoom level 0
+     *
+     * @param {number[]} point - The [lon, lat] point
+     * @returns {number[]} The [x, y] world pixel coordinates
+     */
+    const project = ([lon, lat]) => {
+        const sin = Math.min(Math.max(Math.sin(lat * Math.PI / 180), -0.9999), 0.9999);
+        return [
+            TILE_SIZE * (lon + 180) / 360,
+            TILE_SIZE * (0.5 - Math.log((1 + sin) / (1 - sin)) / (4 * Math.PI))
+        ];
+    };
+
+    /**
+     * Returns the bounding box [minX, minY, maxX, maxY] of projected lines
+     *
+     * @param {number[][][]} lines - The projected lines
+     * @returns {number[]} The bounding box
+     */
+    const boundsOf = (lines) => {
+        const bounds = [Infinity, Infinity, -Infinity, -Infinity];
+        lines.flat().forEach(([x, y]) => {
+            bounds[0] = Math.min(bounds[0], x);
+            bounds[1] = Math.min(bounds[1], y);
+            bounds[2] = Math.max(bounds[2], x);
+            bounds[3] = Math.max(bounds[3], y);
+        });
+        return bounds;
+    };
+
+    class TrailMap {
+        /**
+         * @param {HTMLElement} container - The element to draw the map in
+         * @param {Object} options - Options, with tiles being the URL template of the map tiles
+         */
+        constructor(container, options = {}) {
+            this.container = container;
+            this.tiles = options.tiles || container.dataset.tiles || '';
+            this.features = [];
+            this.bounds = null;
+            this.zoom = MIN_ZOOM;
+            this.center = [TILE_SIZE / 2, TILE_SIZE / 2];
+            this.highlighted = null;
+            this.tileImages = new Map();
+
+            this.tileLayer = document.createElement('div');
+            this.tileLayer.className = 'map-tiles';
+            this.svg = document.createElementNS(SVG_NS, 'svg');
+            this.svg.setAttribute('class', 'map-trails');
+            this.message = document.createElement('div');
+            this.message.className = 'map-message';
+            container.append(this.tileLayer, this.svg, this.message, this.createControls());
+
+            this.addPanAndZoom();
+            window.addEventListener('resize', () => this.render());
+        }
+
+        /**
+         * Creates the zoom in, zoom out and show all buttons
+         */
+        createControls() {
+            const controls = document.createElement('div');
+            controls.className = 'map-controls';
+            [['+', 'Zoom in', () => this.setZoom(this.zoom + 1)],
+             ['−', 'Zoom out', () => this.setZoom(this.zoom - 1)],
+             ['□', 'Show all trails', () => this.fitAll()]].forEach(([label, title, action]) => {
+                const button = document.createElement('button');
+                button.type = 'button';
+                button.textContent = label;
+                button.title = title;
+                button.addEventListener('click', action);
+                controls.append(button);
+            });
+            return controls;
+        }
+
+        /**
+         * Pans the map by dragging, and zooms around the pointer with the mouse wheel
+         */
+        addPanAndZoom() {
+            let drag = null;
+            this.container.addEventListener('pointerdown', (event) => {
+                if (event.target.closest('.map-controls')) return;
+                drag = { x: event.clientX, y: event.clientY, center: this.center.slice() };
+                this.container.setPointerCapture(event.pointerId);
+                this.container.classList.add('dragging');
+            });
+            this.container.addEventListener('pointermove', (event) => {
+                if (!drag) return;
+                const scale = 2 ** this.zoom;
+                this.center = [
+                    drag.center[0] - (event.clientX - drag.x) / scale,
+                    drag.center[1] - (event.clientY - drag.y) / scale
+                ];
+                this.render();
+            });
+            const endDrag = () => {
+                drag = null;
+                this.container.classList.remove('dragging');
+            };
+            this.container.addEventListener('pointerup', endDrag);
+            this.container.addEventListener('pointercancel', endDrag);
+
+            this.container.addEventListener('wheel', (event) => {
+                event.preventDefault();
+                const rect = this.container.getBoundingClientRect();
+                const offset = [event.clientX - rect.left - rect.width / 2, event.clientY - rect.top - rect.height / 2];
+                this.setZoom(this.zoom + (event.deltaY < 0 ? 1 : -1), offset);
+            }, { passive: false });
+        }
+
+        /**
+         * Replaces the drawn features with those of a GeoJSON feature collection
+         *
+         * @param {Object} geojson - The GeoJSON feature collection
+         */
+        setData(geojson) {
+            this.svg.replaceChildren();
+            this.features = (geojson.features || [])
+                .filter(feature => feature.geometry && ['LineString', 'MultiLineString'].includes(feature.geometry.type))
+                .map(feature => {
+                    const coordinates = feature.geometry.type === 'LineString' ? [feature.geometry.coordinates] : feature.geometry.coordinates;
+                    const lines = coordinates.map(line => line.map(project));
+                    const path = document.createElementNS(SVG_NS, 'path');
+                    path.setAttribute('class', `trail trail-${feature.properties.status || 'not-started'}`);
+                    const title = document.createElementNS(SVG_NS, 'title');
+                    title.textContent = [feature.properties.name, feature.properties.park, feature.properties.length]
+                        .filter(Boolean).join(', ');
+                    path.append(title);
+                    this.svg.append(path);
+                    return { id: feature.id, lines, bounds: boundsOf(lines), path };
+                });
+
+            if (this.features.length === 0) {
+                this.showMessage('No trail geometries to show. Generate the page with an OSM region file to draw the trails.');
+                return;
+            }
+            this.showMessage('');
+            this.bounds = boundsOf(this.features.flatMap(feature => feature.lines));
+            this.fitAll();
+        }
+
+        /**
+         * Shows a message over the map, or hides it when empty
+         *
+         * @param {string} text - The message
+         */
+        showMessage(text) {
+            this.message.textContent = text;
+            this.message.hidden = text === '';
+        }
+
+        /**
+         * Zooms the map to show every trail
+         */
+        fitAll() {
+            this.setHighlighted(null);
+            if (this.bounds) this.fitBounds(this.bounds);
+        }
+
+        /**
+         * Zooms the map to a feature and highlights it
+         *
+         * @param {string} id - The feature ID
+         * @returns {boolean} Whether the feature was found
+         */
+        zoomTo(id) {
+            const feature = this.features.find(candidate => candidate.id === id);
+            if (!feature) return false;
+            this.setHighlighted(feature);
+            this.fitBounds(feature.bounds);
+            return true;
+        }
+
+        /**
+         * Highlights a feature, drawing it above the others
+         *
+         * @param {Object|null} feature - The feature, or null for none
+         */
+        setHighlighted(feature) {
+            if (this.highlighted) this.highlighted.path.classList.remove('highlighted');
+            this.highlighted = feature;
+            if (feature) {
+                feature.path.classList.add('highlighted');
+                this.svg.append(feature.path);
+            }
+        }
+
+        /**
+         * Centers the map on a bounding box, at the closest zoom level showing all of it
+         *
+         * @param {number[]} bounds - The bounding box [minX, minY, maxX, maxY] in world pixels
+         */
+        fitBounds([minX, minY, maxX, maxY]) {
+            const width = this.container.clientWidth || TILE_SIZE;
+            const height = this.container.clientHeight || TILE_SIZE;
+            const spanX = Math.max(maxX - minX, 1e-9);
+            const spanY = Math.max(maxY - minY, 1e-9);
+            this.center = [(minX + maxX) / 2, (minY + maxY) / 2];
+            this.setZoom(Math.floor(Math.log2(Math.min(width / spanX, height / spanY) * 0.9)));
+        }
+
+        /**
+         * Sets the zoom level, keeping the point at the given offset from the center in place
+         *
+         * @param {number} zoom - The zoom level
+         * @param {number[]} offset - The [x, y] pixel offset from the center to zoom around
+         */
+        setZoom(zoom, offset = [0, 0]) {
+            zoom = Math.min(Math.max(zoom, MIN_ZOOM), MAX_ZOOM);
+            const before = 2 ** this.zoom;
+            const after = 2 ** zoom;
+            this.center = [
+                this.center[0] + offset[0] / before - offset[0] / after,
+                this.center[1] + offset[1] / before - offset[1] / after
+            ];
+            this.zoom = zoom;
+            this.render();
+        }
+
+        /**
+         * Draws the tiles and trails for the current center and zoom level
+         */
+        render() {
+            const width = this.container.clientWidth;
+            const height = this.container.clientHeight;
+            if (width === 0 || height === 0) return;
+
+            const scale = 2 ** this.zoom;
+            const origin = [this.center[0] * scale - width / 2, this.center[1] * scale - height / 2];
+
+            this.svg.setAttribute('viewBox', `0 0 ${width} ${height}`);
+            this.features.forEach(feature => {
+                const d = feature.lines.map(line => 'M' + line
+                    .map(([x, y]) => `${(x * scale - origin[0]).toFixed(1)},${(y * scale - origin[1]).toFixed(1)}`)
+                    .join('L')).join('');
+                feature.path.setAttribute('d', d);
+            });
+
+            this.renderTiles(origin, width, height);
+        }
+
+        /**
+         * Places the map tiles covering the view, reusing tiles already loaded
+         *
+         * @param {number[]} origin - The world pixel coordinates of the top left corner
+         * @param {number} width - The view width
+         * @param {number} height - The view height
+         */
+        renderTiles(origin, width, height) {
+            if (!this.tiles) return;
+
+            const count = 2 ** this.zoom;
+            const needed = new Set();
+            for (let ty = Math.floor(origin[1] / TILE_SIZE); ty * TILE_SIZE < origin[1] + height; ty++) {
+                if (ty < 0 || ty >= count) continue;
+                for (let tx = Math.floor(origin[0] / TILE_SIZE); tx * TILE_SIZE < origin[0] + width; tx++) {
+                    const x = ((tx % count) + count) % count;
+                    const key = `${this.zoom}/${tx}/${ty}`;
+                    needed.add(key);
+
+                    let image = this.tileImages.get(key);
+                    if (!image) {
+                        image = document.createElement('img');
+                        image.alt = '';
+                        image.draggable = false;
+                        // missing tiles are left blank
+                        image.addEventListener('error', () => { image.style.visibility = 'hidden'; });
+                        image.src = this.tiles.replace('{z}', this.zoom).replace('{x}', x).replace('{y}', ty);
+                        this.tileImages.set(key, image);
+                        this.tileLayer.append(image);
+                    }
+                    image.style.left = `${tx * TILE_SIZE - origin[0]}px`;
+                    image.style.top = `${ty * TILE_SIZE - origin[1]}px`;
+                }
+            }
+
+            this.tileImages.forEach((image, key) => {
+                if (!needed.has(key)) {
+                    image.remove();
+                    this.tileImages.delete(key);
+                }
+            });
+        }
+    }
+
+    window.TrailMap = TrailMap;
+})();
\ No newline at end of file
@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// readExistingChecklist parses the trails of an existing checklist, or returns none if it doesn't exist yet
+func readExistingChecklist(filename string) ([]types.Trail, error) {
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading existing checklist: %w", err)
+	}
+
+	existing, err := parser.ParseTrailsFromChecklist(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing existing checklist: %w", err)
+	}
+	return existing, nil
+}
+
+// checklistKey identifies a trail across checklist generations
+type checklistKey struct {
+	name string
+	park string
+}
+
+// mergeChecklistTrails merges newly generated trails with the trails of the existing
+// checklist. Matching trails, by name and park, keep the existing URL, tags and notes
+// unless the new trail has its own, combine their hikes, and stay completed on the earliest
+// date if either is completed, so a trail is never un-completed. Existing trails
+// missing from the new list are kept if anything was recorded for them.
+func mergeChecklistTrails(existing, trails []types.Trail) []types.Trail {
+	if len(existing) == 0 {
+		return trails
+	}
+
+	existingByKey := make(map[checklistKey]types.Trail, len(existing))
+	for _, trail := range existing {
+		existingByKey[checklistKey{trail.Name, trail.Park}] = trail
+	}
+
+	merged := make([]types.Trail, 0, len(trails))
+	seen := make(map[checklistKey]bool, len(trails))
+	for _, trail := range trails {
+		key := checklistKey{trail.Name, trail.Park}
+		seen[key] = true
+		if old, ok := existingByKey[key]; ok {
+			trail = mergeChecklistTrail(old, trail)
+		}
+		merged = append(merged, trail)
+	}
+
+	for _, old := range existing {
+		key := checklistKey{old.Name, old.Park}
+		if !seen[key] && (old.Completed || len(old.Completions) > 0 || len(old.Tags) > 0 || len(old.Notes) > 0 || old.URL != "") {
+			seen[key] = true
+			merged = append(merged, old)
+		}
+	}
+
+	return merged
+}
+
+// mergeChecklistTrail merges a newly generated trail with the same trail in the existing checklist
+func mergeChecklistTrail(old, trail types.Trail) types.Trail {
+	if trail.URL == "" {
+		trail.URL = old.URL
+	}
+	if len(trail.Tags) == 0 {
+		trail.Tags = old.Tags
+	}
+	if len(trail.Notes) == 0 {
+		trail.Notes = old.Notes
+	}
+	if trail.OSMId == 0 {
+		trail.OSMType, trail.OSMId = old.OSMType, old.OSMId
+	}
+
+	// Coverage only drops when GPX tracks weren't processed this time
+	if old.PercentComplete > trail.PercentComplete {
+		trail.PercentComplete = old.PercentComplete
+		trail.UncoveredSegments = old.UncoveredSegments
+	}
+
+	if old.Completed {
+		trail.CompletionDate = EarliestDate(old.CompletionDate, trail.CompletionDate, trail.Completed)
+		trail.Completed = true
+	}
+
+	trail.Completions = mergeCompletions(old.Completions, trail.Completions)
+	return trail
+}
+
+// EarliestDate returns the earlier of two completion dates, ignoring unknown (zero) dates.
+// The new date is only considered if the new trail is completed.
+func EarliestDate(old, date time.Time, completed bool) time.Time {
+	if !completed || date.IsZero() {
+		return old
+	}
+	if old.IsZero() || date.Before(old) {
+		return date
+	}
+	return old
+}
+
+// mergeCompletions combines two lists of hikes without duplicates, earliest first
+func mergeCompletions(a, b []types.Completion) []types.Completion {
+	seen := make(map[types.Completion]bool, len(a)+len(b))
+	var completions []types.Completion
+	for _, completion := range append(append([]types.Completion{}, a...), b...) {
+		if !seen[completion] {
+			seen[completion] = true
+			completions = append(completions, completion)
+		}
+	}
+	sort.SliceStable(completions, func(i, j int) bool {
+		return completions[i].Date.Before(completions[j].Date)
+	})
+	return completions
+}
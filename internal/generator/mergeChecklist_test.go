@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+func TestGenerateChecklist_MergesExisting(t *testing.T) {
+	checklist := filepath.Join(t.TempDir(), "checklist.md")
+	existing := `# PDX Trails Completionist
+## Forest Park
+- Wildwood Trail
+    - Trail
+    - 30.2 miles
+    - https://example.com/wildwood
+    - Completed 04/01/2024
+    - Hiked 1 time, last on 04/01/2024
+        - 04/01/2024
+    - Bring water
+- Maple Trail
+    - Trail
+    - 4.6 miles
+- Hand Added Trail
+    - Trail
+    - 1.0 miles
+    - Completed 03/01/2024
+`
+	if err := os.WriteFile(checklist, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+	trails := []types.Trail{
+		// Wildwood isn't completed by GPX tracks this time, but was completed by hand
+		{Name: "Wildwood Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(30.2), PercentComplete: 40,
+			Completions: []types.Completion{{Date: day(time.May, 1), SourceFile: "a.gpx"}}},
+		{Name: "Maple Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(4.6), Completed: true, CompletionDate: day(time.May, 2),
+			Completions: []types.Completion{{Date: day(time.May, 2), SourceFile: "b.gpx"}}},
+	}
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat}
+	if err := GenerateChecklist(checklist, trails, opts); err != nil {
+		t.Fatalf("GenerateChecklist returned error: %v", err)
+	}
+	// Regenerating from the same trails doesn't duplicate anything
+	if err := GenerateChecklist(checklist, trails, opts); err != nil {
+		t.Fatalf("GenerateChecklist returned error: %v", err)
+	}
+
+	merged, err := parser.ParseTrailsFromChecklist(checklist)
+	if err != nil {
+		t.Fatalf("ParseTrailsFromChecklist returned error: %v", err)
+	}
+	byName := make(map[string]types.Trail)
+	for _, trail := range merged {
+		byName[trail.Name] = trail
+	}
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 trails, got %d: %v", len(merged), merged)
+	}
+
+	wildwood := byName["Wildwood Trail"]
+	if !wildwood.Completed || !wildwood.CompletionDate.Equal(day(time.April, 1)) {
+		t.Errorf("expected Wildwood Trail to stay completed on 04/01/2024, got %v %v", wildwood.Completed, wildwood.CompletionDate)
+	}
+	if wildwood.URL != "https://example.com/wildwood" || len(wildwood.Notes) != 1 || wildwood.Notes[0] != "Bring water" {
+		t.Errorf("expected Wildwood Trail's URL and note to be kept, got %q %v", wildwood.URL, wildwood.Notes)
+	}
+	if wildwood.HikeCount() != 2 || wildwood.Completions[0].SourceFile != "" || wildwood.Completions[1].SourceFile != "a.gpx" {
+		t.Errorf("expected the hand-recorded and GPX hikes, got %v", wildwood.Completions)
+	}
+	if wildwood.PercentComplete != 40 {
+		t.Errorf("expected Wildwood Trail to be 40%% covered, got %v", wildwood.PercentComplete)
+	}
+
+	if maple := byName["Maple Trail"]; !maple.Completed || !maple.CompletionDate.Equal(day(time.May, 2)) || maple.HikeCount() != 1 {
+		t.Errorf("expected Maple Trail completed by GPX tracks on 05/02/2024, got %v", maple)
+	}
+	if _, ok := byName["Hand Added Trail"]; !ok {
+		t.Error("expected the completed trail missing from the new list to be kept")
+	}
+}
+
+func TestGenerateChecklist_MergesTags(t *testing.T) {
+	checklist := filepath.Join(t.TempDir(), "checklist.md")
+	existing := `<!-- trails-completionist checklist v2 -->
+# PDX Trails Completionist
+## Forest Park
+- Wildwood Trail
+    - type: Trail
+    - length: 30.2 miles
+    - tags: favorite, muddy
+- Tagged Trail
+    - type: Trail
+    - length: 1.0 miles
+    - tags: closed
+- Linked Trail
+    - type: Trail
+    - length: 1.0 miles
+    - url: https://example.com/linked
+- Plain Trail
+    - type: Trail
+    - length: 1.0 miles
+`
+	if err := os.WriteFile(checklist, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	trails := []types.Trail{{Name: "Wildwood Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(30.2), PercentComplete: 40}}
+	if err := GenerateChecklist(checklist, trails, Options{Units: types.Imperial, DateFormat: defaultDateFormat}); err != nil {
+		t.Fatalf("GenerateChecklist returned error: %v", err)
+	}
+
+	merged, err := parser.ParseTrailsFromChecklist(checklist)
+	if err != nil {
+		t.Fatalf("ParseTrailsFromChecklist returned error: %v", err)
+	}
+	byName := make(map[string]types.Trail)
+	for _, trail := range merged {
+		byName[trail.Name] = trail
+	}
+
+	if tags := byName["Wildwood Trail"].Tags; len(tags) != 2 || tags[0] != "favorite" || tags[1] != "muddy" {
+		t.Errorf("expected Wildwood Trail's tags to be kept, got %v", tags)
+	}
+	if tags := byName["Tagged Trail"].Tags; len(tags) != 1 || tags[0] != "closed" {
+		t.Errorf("expected the tagged trail missing from the new list to be kept with its tags, got %v", byName["Tagged Trail"])
+	}
+	if byName["Linked Trail"].URL != "https://example.com/linked" {
+		t.Errorf("expected the trail with a URL missing from the new list to be kept, got %v", byName["Linked Trail"])
+	}
+	if _, ok := byName["Plain Trail"]; ok || len(merged) != 3 {
+		t.Errorf("expected only the trails with something recorded to be kept, got %v", merged)
+	}
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+	"github.com/toozej/trails-completionist/pkg/config"
+	"github.com/toozej/trails-completionist/pkg/osm"
+)
+
+// Options controls how trails are written to the checklist and HTML file
+type Options struct {
+	Units       types.UnitSystem // units trail lengths are written in
+	DateFormat  string           // Go time layout dates are written in, such as 01/02/2006 or 2006-01-02
+	MapTileDir  string           // optional directory of {z}/{x}/{y}.png map tiles, inside the HTML file's directory
+	ParkOrder   ParkOrder        // order parks are written in, alphabetically when empty
+	TrailOrder  TrailOrder       // order trails are written in within each park, alphabetically when empty
+	Region      string           // region the checklist and HTML file are titled with, PDX when empty
+	TemplateDir string           // optional directory of templates, CSS and JS files used over the embedded defaults
+	OSMData     *osm.OSMData     // OSM data trail geometries are drawn from on the map, nil for no geometries
+}
+
+// defaultDateFormat is the date layout used when none is configured
+const defaultDateFormat = "01/02/2006"
+
+// OptionsFromConfig returns the generator options set in the application configuration,
+// after checking the templates work with them. OSMData isn't configuration, and is left
+// for the caller to set.
+func OptionsFromConfig(conf config.Config) (Options, error) {
+	units, err := types.ParseUnitSystem(conf.Units)
+	if err != nil {
+		return Options{}, err
+	}
+
+	parkOrder, err := parseParkOrder(conf.ParkOrder)
+	if err != nil {
+		return Options{}, err
+	}
+	trailOrder, err := parseTrailOrder(conf.TrailOrder)
+	if err != nil {
+		return Options{}, err
+	}
+
+	opts := Options{
+		Units:       units,
+		DateFormat:  conf.DateFormat,
+		MapTileDir:  conf.MapTileDir,
+		ParkOrder:   parkOrder,
+		TrailOrder:  trailOrder,
+		Region:      conf.Region,
+		TemplateDir: conf.TemplateDir,
+	}
+	if opts.DateFormat == "" {
+		opts.DateFormat = defaultDateFormat
+	}
+	if err := validateDateFormat(opts.DateFormat); err != nil {
+		return Options{}, err
+	}
+	if err := validateTemplates(opts); err != nil {
+		return Options{}, err
+	}
+	return opts, nil
+}
+
+// validateDateFormat checks that dates written in a layout can be read back from the
+// checklist, using a day after the 12th so swapped days and months are caught
+func validateDateFormat(layout string) error {
+	want := time.Date(2023, time.October, 28, 0, 0, 0, 0, time.UTC)
+	got, err := parser.ParseChecklistDate(want.Format(layout))
+	if err != nil || !got.Equal(want) {
+		return fmt.Errorf("date format %q can't be read back from the checklist, use a layout such as 01/02/2006 or 2006-01-02", layout)
+	}
+	return nil
+}
+
+// templateFuncs returns the functions available to the checklist and HTML templates
+func templateFuncs(opts Options) template.FuncMap {
+	return template.FuncMap{
+		"distance": func(d types.Distance) string {
+			return d.Format(opts.Units)
+		},
+		"date": func(t time.Time) string {
+			return t.Format(opts.DateFormat)
+		},
+		"join":             strings.Join,
+		"mapID":            mapID,
+		"checklistVersion": func() int { return parser.ChecklistVersion },
+	}
+}
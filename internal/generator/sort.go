@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// ParkOrder is the order parks are written in
+type ParkOrder string
+
+const (
+	ParkOrderName       ParkOrder = "name"       // alphabetically
+	ParkOrderCompletion ParkOrder = "completion" // most completed first
+	ParkOrderLength     ParkOrder = "length"     // most miles of trail first
+)
+
+// TrailOrder is the order trails are written in within each park
+type TrailOrder string
+
+const (
+	TrailOrderName   TrailOrder = "name"   // alphabetically
+	TrailOrderLength TrailOrder = "length" // longest first
+)
+
+// parseParkOrder parses "name", "completion" or "length", defaulting to name when empty
+func parseParkOrder(input string) (ParkOrder, error) {
+	switch ParkOrder(strings.ToLower(strings.TrimSpace(input))) {
+	case "", ParkOrderName:
+		return ParkOrderName, nil
+	case ParkOrderCompletion:
+		return ParkOrderCompletion, nil
+	case ParkOrderLength:
+		return ParkOrderLength, nil
+	default:
+		return "", fmt.Errorf("unknown park order %q, expected name, completion or length", input)
+	}
+}
+
+// parseTrailOrder parses "name" or "length", defaulting to name when empty
+func parseTrailOrder(input string) (TrailOrder, error) {
+	switch TrailOrder(strings.ToLower(strings.TrimSpace(input))) {
+	case "", TrailOrderName:
+		return TrailOrderName, nil
+	case TrailOrderLength:
+		return TrailOrderLength, nil
+	default:
+		return "", fmt.Errorf("unknown trail order %q, expected name or length", input)
+	}
+}
+
+// sortParks sorts parks in the given order. Ties are broken by name, so the order
+// doesn't depend on the order trails were read in.
+func sortParks(parks []ParkTrails, order ParkOrder) {
+	sort.SliceStable(parks, func(i, j int) bool {
+		a, b := parks[i], parks[j]
+		switch order {
+		case ParkOrderCompletion:
+			if a.Stats.Percent() != b.Stats.Percent() {
+				return a.Stats.Percent() > b.Stats.Percent()
+			}
+		case ParkOrderLength:
+			if a.Stats.TotalLength != b.Stats.TotalLength {
+				return a.Stats.TotalLength > b.Stats.TotalLength
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// sortTrails sorts trails in the given order. Ties are broken by name, park, length and
+// type, so the order doesn't depend on the order trails were read in.
+func sortTrails(trails []types.Trail, order TrailOrder) {
+	sort.SliceStable(trails, func(i, j int) bool {
+		a, b := trails[i], trails[j]
+		if order == TrailOrderLength && a.Length != b.Length {
+			return a.Length > b.Length
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Park != b.Park {
+			return a.Park < b.Park
+		}
+		if a.Length != b.Length {
+			return a.Length < b.Length
+		}
+		return a.Type < b.Type
+	})
+}
@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// parkAndTrailNames returns the names of the organized parks and their trails, in order
+func parkAndTrailNames(t *testing.T, trails []types.Trail, opts Options) []string {
+	t.Helper()
+
+	data, err := organizeTrails(trails, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, park := range data.Parks {
+		names = append(names, "## "+park.Name)
+		for _, trail := range park.Trails {
+			names = append(names, trail.Name)
+		}
+	}
+	for _, trail := range data.Unlisted {
+		names = append(names, "unlisted "+trail.Name)
+	}
+	return names
+}
+
+func TestOrganizeTrails_Order(t *testing.T) {
+	trails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Length: types.Miles(30.2)},
+		{Name: "Summit Trail", Park: "Mount Tabor Park", Length: types.Miles(0.5), Completed: true},
+		{Name: "Fire Lane 1", Park: "Forest Park", Length: types.Miles(0.4), Completed: true},
+		{Name: "Quarry Trail", Park: "Forest Park", Length: types.Miles(0.8), Unlisted: true},
+		{Name: "Loop Trail", Park: "Mount Tabor Park", Length: types.Miles(0.9)},
+		{Name: "Abbey Trail", Park: "Powell Butte", Length: types.Miles(0.7), Completed: true},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "by name",
+			opts: Options{},
+			want: []string{"## Forest Park", "Fire Lane 1", "Wildwood Trail", "## Mount Tabor Park", "Loop Trail", "Summit Trail", "## Powell Butte", "Abbey Trail", "unlisted Quarry Trail"},
+		},
+		{
+			name: "parks by completion, trails by length",
+			opts: Options{ParkOrder: ParkOrderCompletion, TrailOrder: TrailOrderLength},
+			want: []string{"## Powell Butte", "Abbey Trail", "## Mount Tabor Park", "Loop Trail", "Summit Trail", "## Forest Park", "Wildwood Trail", "Fire Lane 1", "unlisted Quarry Trail"},
+		},
+		{
+			name: "parks by length",
+			opts: Options{ParkOrder: ParkOrderLength},
+			want: []string{"## Forest Park", "Fire Lane 1", "Wildwood Trail", "## Mount Tabor Park", "Loop Trail", "Summit Trail", "## Powell Butte", "Abbey Trail", "unlisted Quarry Trail"},
+		},
+	}
+	for _, test := range tests {
+		if got := parkAndTrailNames(t, trails, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+
+		// The order doesn't depend on the input order
+		reversed := make([]types.Trail, len(trails))
+		for i, trail := range trails {
+			reversed[len(trails)-1-i] = trail
+		}
+		if got := parkAndTrailNames(t, reversed, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s, reversed input: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseOrders(t *testing.T) {
+	if order, err := parseParkOrder(" Completion "); err != nil || order != ParkOrderCompletion {
+		t.Errorf("parseParkOrder = %q, %v, want completion", order, err)
+	}
+	if order, err := parseParkOrder(""); err != nil || order != ParkOrderName {
+		t.Errorf("parseParkOrder of empty = %q, %v, want name", order, err)
+	}
+	if _, err := parseParkOrder("size"); err == nil {
+		t.Error("expected an error for an unknown park order")
+	}
+	if order, err := parseTrailOrder("length"); err != nil || order != TrailOrderLength {
+		t.Errorf("parseTrailOrder = %q, %v, want length", order, err)
+	}
+	if _, err := parseTrailOrder("completion"); err == nil {
+		t.Error("expected an error for an unknown trail order")
+	}
+}
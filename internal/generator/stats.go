@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"sort"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// maxStatsTrails is how many trails or parks the longest remaining and closest to complete lists show
+const maxStatsTrails = 5
+
+// ParkStats is the progress through the trails of a park, or of every park
+type ParkStats struct {
+	Park            string
+	Completed       int // trails completed
+	Total           int // trails listed
+	CompletedLength types.Distance
+	TotalLength     types.Distance
+}
+
+// add counts a trail towards the park's progress
+func (s *ParkStats) add(trail types.Trail) {
+	s.Total++
+	s.TotalLength += trail.Length
+	if trail.Completed {
+		s.Completed++
+		s.CompletedLength += trail.Length
+	}
+}
+
+// Percent returns the percentage of the park's trail length completed, or of its
+// trails if their lengths are unknown
+func (s ParkStats) Percent() float64 {
+	if s.TotalLength > 0 {
+		return float64(s.CompletedLength / s.TotalLength * 100)
+	}
+	if s.Total > 0 {
+		return float64(s.Completed) / float64(s.Total) * 100
+	}
+	return 0
+}
+
+// PeriodCount is the number of trails completed in a month or year
+type PeriodCount struct {
+	Period string
+	Count  int
+}
+
+// Stats summarizes progress through the listed trails. Unlisted trails aren't
+// part of the list, so aren't counted.
+type Stats struct {
+	Overall            ParkStats
+	Parks              []ParkStats   // in the configured park order
+	CompletionsByYear  []PeriodCount // earliest first
+	CompletionsByMonth []PeriodCount // earliest first
+	LongestRemaining   []types.Trail // longest incomplete trails, longest first
+	ClosestParks       []ParkStats   // incomplete parks closest to 100%, closest first
+}
+
+// buildStats summarizes progress through the trails organized by park
+func buildStats(data TemplateData) Stats {
+	var stats Stats
+	var remaining []types.Trail
+	byYear := make(map[string]int)
+	byMonth := make(map[string]int)
+	var years, months []string
+
+	for _, park := range data.Parks {
+		for _, trail := range park.Trails {
+			stats.Overall.add(trail)
+
+			if !trail.Completed {
+				remaining = append(remaining, trail)
+				continue
+			}
+			if trail.CompletionDate.IsZero() {
+				continue
+			}
+			year, month := trail.CompletionDate.Format("2006"), trail.CompletionDate.Format("2006-01")
+			if byYear[year] == 0 {
+				years = append(years, year)
+			}
+			if byMonth[month] == 0 {
+				months = append(months, month)
+			}
+			byYear[year]++
+			byMonth[month]++
+		}
+		stats.Parks = append(stats.Parks, park.Stats)
+	}
+
+	sort.Strings(years)
+	for _, year := range years {
+		stats.CompletionsByYear = append(stats.CompletionsByYear, PeriodCount{Period: year, Count: byYear[year]})
+	}
+	sort.Strings(months)
+	for _, month := range months {
+		stats.CompletionsByMonth = append(stats.CompletionsByMonth, PeriodCount{Period: month, Count: byMonth[month]})
+	}
+
+	sort.SliceStable(remaining, func(i, j int) bool {
+		if remaining[i].Length != remaining[j].Length {
+			return remaining[i].Length > remaining[j].Length
+		}
+		if remaining[i].Name != remaining[j].Name {
+			return remaining[i].Name < remaining[j].Name
+		}
+		return remaining[i].Park < remaining[j].Park
+	})
+	stats.LongestRemaining = remaining[:min(len(remaining), maxStatsTrails)]
+
+	for _, park := range stats.Parks {
+		if park.Completed < park.Total {
+			stats.ClosestParks = append(stats.ClosestParks, park)
+		}
+	}
+	sort.SliceStable(stats.ClosestParks, func(i, j int) bool {
+		return stats.ClosestParks[i].Percent() > stats.ClosestParks[j].Percent()
+	})
+	stats.ClosestParks = stats.ClosestParks[:min(len(stats.ClosestParks), maxStatsTrails)]
+
+	return stats
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+func TestBuildStats(t *testing.T) {
+	completed := func(month time.Month, year int) time.Time {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	trails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Length: types.Miles(30), Completed: true, CompletionDate: completed(time.October, 2023)},
+		{Name: "Loop Trail", Park: "Mount Tabor Park", Length: types.Miles(1), Completed: true, CompletionDate: completed(time.May, 2024)},
+		{Name: "Fire Lane 1", Park: "Forest Park", Length: types.Miles(1), Completed: true},
+		{Name: "Mountain View Trail", Park: "Powell Butte", Length: types.Miles(2), Completed: true, CompletionDate: completed(time.May, 2024)},
+		{Name: "Leif Erikson Drive", Park: "Forest Park", Length: types.Miles(11)},
+		{Name: "Summit Trail", Park: "Mount Tabor Park", Length: types.Miles(3)},
+		{Name: "Quarry Trail", Length: types.Miles(5), Completed: true, CompletionDate: completed(time.June, 2024), Unlisted: true},
+	}
+	data, err := organizeTrails(trails, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := buildStats(data)
+
+	overall := stats.Overall
+	if overall.Completed != 4 || overall.Total != 6 || overall.CompletedLength.Format(types.Imperial) != "34.0 miles" || overall.TotalLength.Format(types.Imperial) != "48.0 miles" {
+		t.Errorf("unexpected overall stats %+v", overall)
+	}
+	if len(stats.Parks) != 3 || stats.Parks[0].Park != "Forest Park" || stats.Parks[2].Park != "Powell Butte" {
+		t.Errorf("expected parks sorted by name, got %+v", stats.Parks)
+	}
+
+	wantYears := []PeriodCount{{"2023", 1}, {"2024", 2}}
+	if len(stats.CompletionsByYear) != len(wantYears) || stats.CompletionsByYear[0] != wantYears[0] || stats.CompletionsByYear[1] != wantYears[1] {
+		t.Errorf("CompletionsByYear = %+v, want %+v", stats.CompletionsByYear, wantYears)
+	}
+	wantMonths := []PeriodCount{{"2023-10", 1}, {"2024-05", 2}}
+	if len(stats.CompletionsByMonth) != len(wantMonths) || stats.CompletionsByMonth[0] != wantMonths[0] || stats.CompletionsByMonth[1] != wantMonths[1] {
+		t.Errorf("CompletionsByMonth = %+v, want %+v", stats.CompletionsByMonth, wantMonths)
+	}
+
+	if len(stats.LongestRemaining) != 2 || stats.LongestRemaining[0].Name != "Leif Erikson Drive" || stats.LongestRemaining[1].Name != "Summit Trail" {
+		t.Errorf("unexpected longest remaining trails %+v", stats.LongestRemaining)
+	}
+
+	// Forest Park is 31 of 42 miles along, Mount Tabor Park 1 of 4, and Powell Butte is complete
+	if len(stats.ClosestParks) != 2 || stats.ClosestParks[0].Park != "Forest Park" || stats.ClosestParks[1].Park != "Mount Tabor Park" {
+		t.Errorf("unexpected closest parks %+v", stats.ClosestParks)
+	}
+}
+
+func TestParkStatsPercent(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats ParkStats
+		want  float64
+	}{
+		{"by length", ParkStats{Completed: 1, Total: 2, CompletedLength: types.Miles(1), TotalLength: types.Miles(4)}, 25},
+		{"unknown lengths", ParkStats{Completed: 1, Total: 2}, 50},
+		{"no trails", ParkStats{}, 0},
+	}
+	for _, test := range tests {
+		if got := test.stats.Percent(); got != test.want {
+			t.Errorf("%s: Percent() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
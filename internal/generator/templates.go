@@ -1,6 +1,150 @@
 package generator
 
-import "embed"
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
 
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// Templates holds the default checklist and HTML templates, and the CSS and JS files
+// copied next to the HTML file. Files in Options.TemplateDir take their place, see templateFS.
+//
 //go:embed *.tmpl *.js *.css
 var Templates embed.FS
+
+const (
+	checklistTemplate = "checklist.md.tmpl" // executed to write the checklist, with any other *.md.tmpl files
+	htmlTemplate      = "trails.html.tmpl"  // executed to write the HTML file, with any other *.html.tmpl files
+)
+
+// defaultRegion is the region the checklist and HTML file are titled with when none is configured
+const defaultRegion = "PDX"
+
+// TemplateData is the data the checklist and HTML templates are executed with. Besides
+// the standard template functions, templates can call:
+//
+//	distance   writes a types.Distance in the configured units, as in {{distance .Length}}
+//	date       writes a time.Time in the configured date format, as in {{date .Generated}}
+//	join       joins strings, as in {{join .Tags ", "}}
+//	mapID      returns a trail's ID on the HTML file's map, or "" if it isn't drawn
+//	checklistVersion  returns the version of the checklist grammar, see parser.ChecklistVersion
+//
+// Trails are types.Trail, so templates can use any of its fields and methods.
+type TemplateData struct {
+	Region    string        // region the trails are in, such as PDX
+	Generated time.Time     // when the checklist or HTML file was generated
+	Parks     []ParkTrails  // listed trails, by park, in the configured order
+	Unlisted  []types.Trail // trails found in GPX tracks but missing from the raw input list
+	MapTiles  string        // URL template of the local map tiles, relative to the HTML file, if any
+	Stats     Stats         // progress through the listed trails
+}
+
+// ParkTrails is a park's listed trails
+type ParkTrails struct {
+	Name   string
+	Trails []types.Trail // in the configured order
+	Stats  ParkStats
+}
+
+// overlayFS reads files from a directory of user templates, falling back to the embedded defaults
+type overlayFS struct {
+	overlay fs.FS
+	base    fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.overlay.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// ReadDir lists the files of both, so templates, CSS and JS files added in the overlay are used too
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.overlay, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	if baseErr != nil {
+		if err != nil || !errors.Is(baseErr, fs.ErrNotExist) {
+			return nil, baseErr
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		seen[entry.Name()] = true
+	}
+	for _, entry := range baseEntries {
+		if !seen[entry.Name()] {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// templateFS returns the templates, CSS and JS files to generate output with: those in
+// templateDir, if set, over the embedded defaults
+func templateFS(templateDir string) fs.FS {
+	if templateDir == "" {
+		return Templates
+	}
+	return overlayFS{overlay: os.DirFS(templateDir), base: Templates}
+}
+
+// validateTemplates parses the checklist and HTML templates and executes them with sample
+// trails, so mistakes in user templates are reported before any trails are processed
+func validateTemplates(opts Options) error {
+	if opts.TemplateDir != "" {
+		if info, err := os.Stat(opts.TemplateDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("template directory %s not found", opts.TemplateDir)
+		}
+	}
+	fsys := templateFS(opts.TemplateDir)
+	data, err := organizeTrails(sampleTrails(), opts)
+	if err != nil {
+		return err
+	}
+
+	checklist, err := parseMDTemplate(fsys, opts)
+	if err != nil {
+		return err
+	}
+	if err := checklist.Execute(io.Discard, data); err != nil {
+		return fmt.Errorf("error in checklist template: %w", err)
+	}
+
+	html, err := parseHTMLTemplate(fsys, opts)
+	if err != nil {
+		return err
+	}
+	if err := html.Execute(io.Discard, data); err != nil {
+		return fmt.Errorf("error in HTML template: %w", err)
+	}
+	return nil
+}
+
+// sampleTrails returns trails setting every field templates are likely to use
+func sampleTrails() []types.Trail {
+	day := time.Date(2023, time.October, 28, 0, 0, 0, 0, time.UTC)
+	return []types.Trail{
+		{
+			Name: "Sample Trail", Park: "Sample Park", Type: "Trail", Length: types.Miles(1),
+			URL: "https://example.com/sample-trail", Completed: true, CompletionDate: day,
+			PercentComplete: 100, Completions: []types.Completion{{Date: day, SourceFile: "sample.gpx"}},
+			OSMId: 1, OSMType: "way", Tags: []string{"sample"}, Notes: []string{"Sample note"},
+		},
+		{Name: "Sample Connector", Park: "Sample Park", Type: "Connector", Length: types.Miles(0.5), PercentComplete: 50, UncoveredSegments: []types.TrailSegment{{Start: 0, End: 0.2}}},
+		{Name: "Sample Unlisted Trail", Park: "Sample Park", Type: "Trail", Length: types.Miles(0.2), Unlisted: true},
+	}
+}
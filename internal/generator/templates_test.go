@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// writeTemplateDir writes files to a new template directory, returning its path
+func writeTemplateDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerateHTMLOutput_TemplateDir(t *testing.T) {
+	templateDir := writeTemplateDir(t, map[string]string{
+		"trails.html.tmpl": `<h1>{{.Region}}</h1>{{template "count" .}}`,
+		"count.html.tmpl":  `{{define "count"}}<p>{{.Stats.Overall.Completed}} of {{.Stats.Overall.Total}}</p>{{end}}`,
+		"extra.css":        "h1 { color: green; }",
+	})
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat, Region: "Seattle", TemplateDir: templateDir}
+	if err := validateTemplates(opts); err != nil {
+		t.Fatalf("validateTemplates returned error: %v", err)
+	}
+
+	outputDir := t.TempDir()
+	trails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Completed: true},
+		{Name: "Loop Trail", Park: "Mount Tabor Park"},
+	}
+	if err := GenerateHTMLOutput(filepath.Join(outputDir, "trails.html"), trails, opts); err != nil {
+		t.Fatalf("GenerateHTMLOutput returned error: %v", err)
+	}
+
+	html, err := os.ReadFile(filepath.Join(outputDir, "trails.html")) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>Seattle</h1><p>1 of 2</p>"; string(html) != want {
+		t.Errorf("HTML = %q, want %q", html, want)
+	}
+
+	// Static files are copied from the template directory, falling back to the defaults
+	for _, file := range []string{"extra.css", "styles.css", "app.js", "map.js", "trails.geojson.js"} {
+		if _, err := os.Stat(filepath.Join(outputDir, file)); err != nil {
+			t.Errorf("expected %s to be copied: %v", file, err)
+		}
+	}
+}
+
+func TestGenerateHTMLOutput_KeepsPageOnError(t *testing.T) {
+	templateDir := writeTemplateDir(t, map[string]string{
+		"trails.html.tmpl": `<h1>{{.Region.Name}}</h1>`,
+	})
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat, TemplateDir: templateDir}
+
+	outputDir := t.TempDir()
+	output := filepath.Join(outputDir, "trails.html")
+	if err := os.WriteFile(output, []byte("<h1>Portland</h1>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateHTMLOutput(output, []types.Trail{{Name: "Loop Trail", Park: "Mount Tabor Park"}}, opts); err == nil {
+		t.Fatal("expected GenerateHTMLOutput to fail executing the template")
+	}
+
+	html, err := os.ReadFile(output) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>Portland</h1>"; string(html) != want {
+		t.Errorf("HTML = %q, want the existing page %q", html, want)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("expected the temporary file %s to be removed", entry.Name())
+		}
+	}
+}
+
+func TestGenerateChecklist_Region(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "checklist.md")
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat, Region: "Seattle"}
+	if err := GenerateChecklist(output, []types.Trail{{Name: "Loop Trail", Park: "Discovery Park"}}, opts); err != nil {
+		t.Fatalf("GenerateChecklist returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(output) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\n# Seattle Trails Completionist\n") {
+		t.Errorf("expected the checklist to be titled with the region, got:\n%s", got)
+	}
+}
+
+func TestValidateTemplates_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"syntax error", map[string]string{"trails.html.tmpl": "{{range .Parks}}"}, "error parsing HTML template"},
+		{"unknown field", map[string]string{"checklist.md.tmpl": "# {{.Regoin}}"}, "error in checklist template"},
+		{"unknown function", map[string]string{"trails.html.tmpl": "{{miles .Stats.Overall.TotalLength}}"}, `function "miles" not defined`},
+	}
+	for _, test := range tests {
+		opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat, TemplateDir: writeTemplateDir(t, test.files)}
+		err := validateTemplates(opts)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: validateTemplates = %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+
+	opts := Options{Units: types.Imperial, DateFormat: defaultDateFormat, TemplateDir: filepath.Join(t.TempDir(), "missing")}
+	if err := validateTemplates(opts); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("validateTemplates with a missing directory = %v, want not found", err)
+	}
+	if err := validateTemplates(Options{Units: types.Imperial, DateFormat: defaultDateFormat}); err != nil {
+		t.Errorf("validateTemplates of the default templates returned error: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package matcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Aliases maps normalized alternative trail names, as used by OSM or GPX tracks,
+// to the name of the trail in the raw input list
+type Aliases map[string]string
+
+// LoadAliases loads a user-maintained alias file, with one alias per line in the form
+//
+//	Wildwood Trail #3 = Wildwood Trail
+//
+// where the left side is the name found in GPX tracks and the right side is the name
+// in the raw input list. Blank lines and lines starting with # are ignored.
+func LoadAliases(filename string) (Aliases, error) {
+	f, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error opening alias file: %w", err)
+	}
+	defer f.Close()
+
+	aliases := make(Aliases)
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		alias, name, ok := strings.Cut(line, "=")
+		alias, name = strings.TrimSpace(alias), strings.TrimSpace(name)
+		if !ok || alias == "" || name == "" {
+			return nil, fmt.Errorf("invalid alias on line %d of %s, expected \"GPX name = listed name\"", lineNumber, filename)
+		}
+		aliases[NormalizeName(alias)] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading alias file: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// Resolve returns the listed name for a trail name, if it has an alias
+func (a Aliases) Resolve(name string) (string, bool) {
+	listed, ok := a[NormalizeName(name)]
+	return listed, ok
+}
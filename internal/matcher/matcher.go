@@ -2,12 +2,56 @@ package matcher
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/toozej/trails-completionist/internal/types"
+	"github.com/toozej/trails-completionist/pkg/config"
 )
 
-// Match completed / GPX Trails with raw input Trails, creating a combined list of Trails
-func MatchTrails(completedTrails []types.Trail, rawTrails []types.Trail) ([]types.Trail, error) {
+// maxCandidates is how many of the closest listed trails are reported for an unmatched GPX trail
+const maxCandidates = 3
+
+// Options controls how GPX trails are matched to raw input trails
+type Options struct {
+	Aliases         Aliases // alternative names of listed trails, checked before fuzzy matching
+	Threshold       float64 // minimum name Similarity for a fuzzy match
+	IncludeUnlisted bool    // add GPX trails which match no listed trail to the combined list
+}
+
+// OptionsFromConfig returns the matcher options set in the application configuration,
+// loading the alias file if one is configured
+func OptionsFromConfig(conf config.Config) (Options, error) {
+	opts := Options{Threshold: conf.NameMatchThreshold, IncludeUnlisted: conf.IncludeUnlisted}
+	if conf.AliasFile != "" {
+		aliases, err := LoadAliases(conf.AliasFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Aliases = aliases
+	}
+	return opts, nil
+}
+
+// Candidate is a listed trail scored against the name of a GPX trail
+type Candidate struct {
+	Name  string
+	Park  string
+	Score float64
+}
+
+// Unmatched is a GPX trail which didn't match any listed trail, with the closest listed trails
+type Unmatched struct {
+	Trail      types.Trail
+	Candidates []Candidate
+}
+
+// Match completed / GPX Trails with raw input Trails, creating a combined list of Trails.
+// GPX trails are matched by alias first, then by the most similar normalized name scoring
+// at least opts.Threshold. GPX trails which match nothing are reported with the closest
+// listed trails, so aliases can be added for them, and if opts.IncludeUnlisted is set
+// they are added to the end of the combined list marked as unlisted.
+func MatchTrails(completedTrails []types.Trail, rawTrails []types.Trail, opts Options) ([]types.Trail, error) {
 	var combinedTrails []types.Trail
 
 	// If completedTrails is empty, return rawTrails as is
@@ -15,31 +59,213 @@ func MatchTrails(completedTrails []types.Trail, rawTrails []types.Trail) ([]type
 		return rawTrails, fmt.Errorf("no completed trails found, therefore no matches to be made. Returning raw trails")
 	}
 
+	matched, unmatched := assignTrails(completedTrails, rawTrails, opts)
+
 	// Iterate over raw trails
-	for _, raw := range rawTrails {
-		matched := false
-		for _, completed := range completedTrails {
-			// Check if the names match
-			if completed.Name == raw.Name {
-				// Replace rawTrail with completedTrail's details
-				combinedTrails = append(combinedTrails, types.Trail{
-					Name:           raw.Name, // Keep the raw trail's name
-					Park:           raw.Park, // Keep the raw trail's park
-					Type:           completed.Type,
-					Length:         completed.Length,
-					URL:            raw.URL, // Keep the raw trail's URL
-					Completed:      completed.Completed,
-					CompletionDate: completed.CompletionDate,
-				})
-				matched = true
-				break
-			}
-		}
-		if !matched {
+	for i, raw := range rawTrails {
+		if len(matched[i]) == 0 {
 			// If no match, add the raw trail as is
 			combinedTrails = append(combinedTrails, raw)
+			continue
+		}
+
+		// Replace rawTrail with completedTrail's details
+		completed := mergeTrails(matched[i])
+		combinedTrails = append(combinedTrails, types.Trail{
+			Name:              raw.Name, // Keep the raw trail's name
+			Park:              raw.Park, // Keep the raw trail's park
+			Type:              completed.Type,
+			Length:            completed.Length,
+			URL:               raw.URL, // Keep the raw trail's URL
+			Completed:         completed.Completed,
+			CompletionDate:    completed.CompletionDate,
+			PercentComplete:   completed.PercentComplete,
+			UncoveredSegments: completed.UncoveredSegments,
+			Completions:       completed.Completions,
+			OSMId:             completed.OSMId,
+			OSMType:           completed.OSMType,
+		})
+	}
+
+	for _, u := range unmatched {
+		park := ""
+		if u.Trail.Park != "" {
+			park = " in " + u.Trail.Park
+		}
+		fmt.Printf("GPX trail %q%s didn't match any listed trail%s\n", u.Trail.Name, park, formatCandidates(u.Candidates))
+
+		if opts.IncludeUnlisted {
+			unlisted := u.Trail
+			unlisted.Unlisted = true
+			combinedTrails = append(combinedTrails, unlisted)
 		}
 	}
 
 	return combinedTrails, nil
 }
+
+// FindUnmatched returns the GPX trails which don't match any raw input trail, along
+// with the closest raw input trails to each
+func FindUnmatched(completedTrails []types.Trail, rawTrails []types.Trail, opts Options) []Unmatched {
+	_, unmatched := assignTrails(completedTrails, rawTrails, opts)
+	return unmatched
+}
+
+// assignTrails finds the raw trail each GPX trail matches, returning the GPX trails
+// matched to each raw trail by index, and the GPX trails which matched nothing
+func assignTrails(completedTrails []types.Trail, rawTrails []types.Trail, opts Options) (map[int][]types.Trail, []Unmatched) {
+	normalizedRaw := make([]normalizedName, len(rawTrails))
+	for i, raw := range rawTrails {
+		normalizedRaw[i] = normalize(raw.Name)
+	}
+
+	matched := make(map[int][]types.Trail)
+	var unmatched []Unmatched
+	for _, completed := range completedTrails {
+		index, candidates := findRawTrail(completed, rawTrails, normalizedRaw, opts)
+		if index < 0 {
+			unmatched = append(unmatched, Unmatched{Trail: completed, Candidates: candidates})
+			continue
+		}
+		matched[index] = append(matched[index], completed)
+	}
+	return matched, unmatched
+}
+
+// findRawTrail returns the index of the raw trail matching a GPX trail, or -1 along
+// with the closest raw trails if none match. Listed parks are often whole regions, so
+// the park only chooses between several listed trails matching the name, keeping
+// same-named trails in different parks from colliding: a listed trail in a matching
+// park is preferred, and otherwise the name must match one listed trail better than
+// any other.
+func findRawTrail(completed types.Trail, rawTrails []types.Trail, normalizedRaw []normalizedName, opts Options) (int, []Candidate) {
+	name := completed.Name
+
+	// An alias names the listed trail exactly, so is always honored
+	if listed, ok := opts.Aliases.Resolve(name); ok {
+		listedName := normalize(listed)
+		match := -1
+		for i, raw := range rawTrails {
+			if normalizedRaw[i].compact != listedName.compact {
+				continue
+			}
+			if parksMatch(completed.Park, raw.Park, opts.Threshold) {
+				match = i
+				break
+			}
+			if match < 0 {
+				match = i
+			}
+		}
+		if match >= 0 {
+			return match, nil
+		}
+		fmt.Printf("Alias %q -> %q doesn't name a listed trail\n", name, listed)
+	}
+
+	gpxName := normalize(name)
+	best, bestScore, tied := -1, 0.0, false // best name match in any park
+	bestInPark, bestInParkScore := -1, 0.0  // best name match in a matching park
+	candidates := make([]Candidate, 0, len(rawTrails))
+	for i, raw := range rawTrails {
+		score := similarity(gpxName, normalizedRaw[i])
+		candidates = append(candidates, Candidate{Name: raw.Name, Park: raw.Park, Score: score})
+		if score < opts.Threshold {
+			continue
+		}
+
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = i, score, false
+		case score == bestScore:
+			tied = true
+		}
+		if score > bestInParkScore && parksMatch(completed.Park, raw.Park, opts.Threshold) {
+			bestInPark, bestInParkScore = i, score
+		}
+	}
+	if bestInPark >= 0 {
+		return bestInPark, nil
+	}
+	if best >= 0 && !tied {
+		return best, nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	var closest []Candidate
+	for _, candidate := range candidates {
+		if len(closest) == maxCandidates || candidate.Score == 0 {
+			break
+		}
+		closest = append(closest, candidate)
+	}
+	return -1, closest
+}
+
+// parksMatch checks if a GPX trail's park, from OSM park boundaries, can be the park of a
+// listed trail. Park names are compared like trail names, and one may also contain the
+// other, as in "Forest Park" and "Forest Park Natural Area". Missing parks match any park.
+func parksMatch(gpxPark, listedPark string, threshold float64) bool {
+	if gpxPark == "" || listedPark == "" {
+		return true
+	}
+	a, b := normalize(gpxPark), normalize(listedPark)
+	return similarity(a, b) >= threshold || strings.Contains(a.compact, b.compact) || strings.Contains(b.compact, a.compact)
+}
+
+// formatCandidates formats the closest listed trails for an unmatched GPX trail
+func formatCandidates(candidates []Candidate) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	parts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		parts[i] = fmt.Sprintf("%q (%.2f)", candidate.Name, candidate.Score)
+		if candidate.Park != "" {
+			parts[i] = fmt.Sprintf("%q in %s (%.2f)", candidate.Name, candidate.Park, candidate.Score)
+		}
+	}
+	return ", closest: " + strings.Join(parts, ", ")
+}
+
+// mergeTrails combines several GPX trails matched to the same listed trail, such as
+// separately mapped sections of it. The most covered trail provides the details, the
+// earliest completion date is kept, and the hikes of every trail are combined.
+func mergeTrails(trails []types.Trail) types.Trail {
+	if len(trails) == 1 {
+		return trails[0]
+	}
+
+	merged := trails[0]
+	for _, trail := range trails[1:] {
+		if trail.PercentComplete > merged.PercentComplete {
+			merged.Type = trail.Type
+			merged.Length = trail.Length
+			merged.PercentComplete = trail.PercentComplete
+			merged.UncoveredSegments = trail.UncoveredSegments
+			merged.OSMId = trail.OSMId
+			merged.OSMType = trail.OSMType
+		}
+		if trail.Completed && (!merged.Completed || trail.CompletionDate.Before(merged.CompletionDate)) {
+			merged.Completed = true
+			merged.CompletionDate = trail.CompletionDate
+		}
+	}
+
+	// Combine the hikes, counting a GPX file which covered several sections once
+	seen := make(map[types.Completion]bool)
+	merged.Completions = nil
+	for _, trail := range trails {
+		for _, completion := range trail.Completions {
+			if !seen[completion] {
+				seen[completion] = true
+				merged.Completions = append(merged.Completions, completion)
+			}
+		}
+	}
+	sort.SliceStable(merged.Completions, func(i, j int) bool {
+		return merged.Completions[i].Date.Before(merged.Completions[j].Date)
+	})
+
+	return merged
+}
@@ -0,0 +1,220 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// date parses a MM/DD/YYYY test date
+func date(s string) time.Time {
+	parsed, err := time.Parse("01/02/2006", s)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Wildwood Trail", "wildwood trail"},
+		{"Wildwood Tr.", "wildwood trail"},
+		{"NW Saltzman Rd", "northwest saltzman road"},
+		{"Firelane #04", "firelane 4"},
+		{"Fire Lane No. 4", "fire lane 4"},
+		{"Firelane Four", "firelane 4"},
+		{"Dog's Trail & Loop", "dogs trail and loop"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeName(tt.input); got != tt.expected {
+			t.Errorf("NormalizeName(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		match bool
+	}{
+		{"Firelane 4", "Fire Lane 4", true},
+		{"Wildwood Trail #3", "Wildwood Trail", true},
+		{"Leif Erikson Dr", "Leif Erikson Drive", true},
+		{"Maple Trl", "Maple Trail", true},
+		{"Firelane 4", "Firelane 5", false},
+		{"Wildwood Trail", "Wild Cherry Trail", false},
+		{"Loop Trail", "Lower Macleay Trail", false},
+	}
+
+	for _, tt := range tests {
+		if score := Similarity(tt.a, tt.b); (score >= 0.85) != tt.match {
+			t.Errorf("Similarity(%q, %q) = %.2f, expected match %v", tt.a, tt.b, score, tt.match)
+		}
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	aliasFile := filepath.Join(t.TempDir(), "aliases.txt")
+	content := "# GPX name = listed name\n\nBPA Road = Power Line Road\n"
+	if err := os.WriteFile(aliasFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := LoadAliases(aliasFile)
+	if err != nil {
+		t.Fatalf("LoadAliases returned error: %v", err)
+	}
+	if listed, ok := aliases.Resolve("BPA Rd"); !ok || listed != "Power Line Road" {
+		t.Errorf("expected BPA Rd to resolve to Power Line Road, got %q %v", listed, ok)
+	}
+
+	if err := os.WriteFile(aliasFile, []byte("no separator\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAliases(aliasFile); err == nil {
+		t.Error("expected invalid alias line to be rejected")
+	}
+}
+
+func TestMatchTrails(t *testing.T) {
+	rawTrails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(30.2)},
+		{Name: "Fire Lane 4", Park: "Forest Park", Type: "Trail", Length: types.Miles(1.0)},
+		{Name: "Power Line Road", Park: "Forest Park", Type: "Trail", Length: types.Miles(3.9)},
+		{Name: "Maple Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(4.6)},
+	}
+	completedTrails := []types.Trail{
+		{Name: "Wildwood Trail #3", Type: "Trail", Length: types.Miles(30.2), PercentComplete: 40,
+			Completions: []types.Completion{{Date: date("05/03/2024"), SourceFile: "b.gpx"}}},
+		{Name: "Wildwood Trail", Type: "Trail", Length: types.Miles(30.1), PercentComplete: 95, Completed: true, CompletionDate: date("06/01/2024"),
+			Completions: []types.Completion{{Date: date("05/01/2024"), SourceFile: "a.gpx"}, {Date: date("06/01/2024"), SourceFile: "c.gpx"}}},
+		{Name: "Firelane 4", Type: "Trail", Length: types.Miles(1.0), Completed: true, CompletionDate: date("04/01/2024")},
+		{Name: "BPA Road", Type: "Trail", Length: types.Miles(3.9), Completed: true, CompletionDate: date("04/02/2024")},
+		{Name: "Firelane 5", Type: "Trail", Length: types.Miles(0.8), Completed: true, CompletionDate: date("04/01/2024")},
+	}
+	opts := Options{Aliases: Aliases{NormalizeName("BPA Road"): "Power Line Road"}, Threshold: 0.85}
+
+	combined, err := MatchTrails(completedTrails, rawTrails, opts)
+	if err != nil {
+		t.Fatalf("MatchTrails returned error: %v", err)
+	}
+	if len(combined) != len(rawTrails) {
+		t.Fatalf("expected %d trails, got %d", len(rawTrails), len(combined))
+	}
+
+	wildwood := combined[0]
+	if !wildwood.Completed || wildwood.PercentComplete != 95 || wildwood.Length != types.Miles(30.1) || wildwood.HikeCount() != 3 {
+		t.Errorf("expected both Wildwood sections merged, got %+v", wildwood)
+	}
+	if wildwood.Park != "Forest Park" || !wildwood.LastHiked().Equal(date("06/01/2024")) {
+		t.Errorf("expected listed park and last hike kept, got %+v", wildwood)
+	}
+	if !combined[1].Completed || !combined[2].Completed {
+		t.Errorf("expected fuzzy and alias matches to be completed, got %+v and %+v", combined[1], combined[2])
+	}
+	if combined[3].Completed {
+		t.Errorf("expected unhiked trail to stay incomplete, got %+v", combined[3])
+	}
+
+	_, unmatched := assignTrails(completedTrails, rawTrails, opts)
+	if len(unmatched) != 1 || unmatched[0].Trail.Name != "Firelane 5" {
+		t.Fatalf("expected Firelane 5 to be unmatched, got %+v", unmatched)
+	}
+}
+
+func TestMatchTrails_Parks(t *testing.T) {
+	rawTrails := []types.Trail{
+		{Name: "Loop Trail", Park: "Powell Butte Nature Park"},
+		{Name: "Loop Trail", Park: "Tryon Creek State Natural Area"},
+		{Name: "Maple Trail", Park: "Forest Park"},
+	}
+	completedTrails := []types.Trail{
+		{Name: "Loop Trail", Park: "Tryon Creek State Natural Area", Completed: true, CompletionDate: date("04/01/2024")},
+		{Name: "Maple Trail", Park: "Forest Park Natural Area", Completed: true, CompletionDate: date("04/02/2024")},
+		{Name: "Loop Trail", Park: "Mount Tabor Park", Completed: true, CompletionDate: date("04/03/2024")},
+	}
+
+	combined, err := MatchTrails(completedTrails, rawTrails, Options{Threshold: 0.85})
+	if err != nil {
+		t.Fatalf("MatchTrails returned error: %v", err)
+	}
+	if combined[0].Completed || !combined[1].Completed {
+		t.Errorf("expected only the Loop Trail in Tryon Creek completed, got %+v", combined[:2])
+	}
+	if !combined[2].Completed {
+		t.Errorf("expected Maple Trail to match a park name containing the listed park, got %+v", combined[2])
+	}
+
+	_, unmatched := assignTrails(completedTrails, rawTrails, Options{Threshold: 0.85})
+	if len(unmatched) != 1 || unmatched[0].Trail.Park != "Mount Tabor Park" {
+		t.Errorf("expected the Loop Trail in another park to be unmatched, got %+v", unmatched)
+	}
+}
+
+func TestMatchTrails_RegionParks(t *testing.T) {
+	// Listed parks are often regions rather than OSM parks
+	rawTrails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Portland Metro and Mt. Hood"},
+		{Name: "Power Line Road", Park: "Portland"},
+		{Name: "Loop Trail", Park: "Portland"},
+		{Name: "Loop Trail", Park: "Tryon Creek State Natural Area"},
+	}
+	completedTrails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Completed: true, CompletionDate: date("04/01/2024")},
+		{Name: "BPA Road", Park: "Forest Park", Completed: true, CompletionDate: date("04/02/2024")},
+		{Name: "Loop Trail", Park: "Tryon Creek State Natural Area", Completed: true, CompletionDate: date("04/03/2024")},
+		{Name: "Loop Trail", Park: "Mount Tabor Park", Completed: true, CompletionDate: date("04/04/2024")},
+	}
+	opts := Options{Aliases: Aliases{NormalizeName("BPA Road"): "Power Line Road"}, Threshold: 0.85}
+
+	combined, err := MatchTrails(completedTrails, rawTrails, opts)
+	if err != nil {
+		t.Fatalf("MatchTrails returned error: %v", err)
+	}
+	if !combined[0].Completed {
+		t.Errorf("expected a unique name to match a listed trail in a region, got %+v", combined[0])
+	}
+	if !combined[1].Completed {
+		t.Errorf("expected the alias to match a listed trail in a region, got %+v", combined[1])
+	}
+	if combined[2].Completed || !combined[3].Completed {
+		t.Errorf("expected the park to choose the Loop Trail in Tryon Creek, got %+v", combined[2:])
+	}
+
+	// Same-named trails in other parks are ambiguous, so the park can't be ignored
+	_, unmatched := assignTrails(completedTrails, rawTrails, opts)
+	if len(unmatched) != 1 || unmatched[0].Trail.Park != "Mount Tabor Park" {
+		t.Errorf("expected the Loop Trail in Mount Tabor Park to be unmatched, got %+v", unmatched)
+	}
+}
+
+func TestMatchTrails_IncludeUnlisted(t *testing.T) {
+	rawTrails := []types.Trail{{Name: "Wildwood Trail", Park: "Forest Park"}}
+	completedTrails := []types.Trail{
+		{Name: "Wildwood Trail", Completed: true, CompletionDate: date("04/01/2024")},
+		{Name: "Ridge Trail", Park: "Forest Park", OSMId: 42, OSMType: "way"},
+	}
+
+	combined, err := MatchTrails(completedTrails, rawTrails, Options{Threshold: 0.85})
+	if err != nil {
+		t.Fatalf("MatchTrails returned error: %v", err)
+	}
+	if len(combined) != 1 {
+		t.Fatalf("expected unlisted trails to be left out by default, got %+v", combined)
+	}
+
+	combined, err = MatchTrails(completedTrails, rawTrails, Options{Threshold: 0.85, IncludeUnlisted: true})
+	if err != nil {
+		t.Fatalf("MatchTrails returned error: %v", err)
+	}
+	if len(combined) != 2 || !combined[1].Unlisted || combined[1].OSMId != 42 || combined[0].Unlisted {
+		t.Errorf("expected Ridge Trail added as unlisted, got %+v", combined)
+	}
+}
@@ -0,0 +1,183 @@
+package matcher
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// abbreviations expands common abbreviations in trail names, so "Leif Erikson Dr"
+// and "Leif Erikson Drive" normalize to the same name
+var abbreviations = map[string]string{
+	"rd":   "road",
+	"tr":   "trail",
+	"trl":  "trail",
+	"ln":   "lane",
+	"dr":   "drive",
+	"ave":  "avenue",
+	"av":   "avenue",
+	"blvd": "boulevard",
+	"pkwy": "parkway",
+	"hwy":  "highway",
+	"mt":   "mount",
+	"mtn":  "mountain",
+	"crk":  "creek",
+	"ck":   "creek",
+	"cyn":  "canyon",
+	"pt":   "point",
+	"n":    "north",
+	"s":    "south",
+	"e":    "east",
+	"w":    "west",
+	"ne":   "northeast",
+	"nw":   "northwest",
+	"se":   "southeast",
+	"sw":   "southwest",
+	"&":    "and",
+}
+
+// numberWords converts spelled out numbers to digits, so "Firelane One" matches "Firelane 1"
+var numberWords = map[string]string{
+	"one": "1", "two": "2", "three": "3", "four": "4", "five": "5",
+	"six": "6", "seven": "7", "eight": "8", "nine": "9", "ten": "10",
+	"eleven": "11", "twelve": "12", "thirteen": "13", "fourteen": "14", "fifteen": "15",
+}
+
+// normalizedName is a trail name broken into comparable forms
+type normalizedName struct {
+	tokens  []string // lowercase words with abbreviations expanded
+	compact string   // tokens joined without spaces, so "Firelane" matches "Fire Lane"
+	numbers []string // numeric tokens, which must agree between two names to match
+}
+
+// NormalizeName returns a trail name in lowercase, without punctuation, with
+// abbreviations expanded and numbers written as digits without leading zeros
+func NormalizeName(name string) string {
+	return strings.Join(normalize(name).tokens, " ")
+}
+
+// normalize breaks a trail name into its normalized forms
+func normalize(name string) normalizedName {
+	// Apostrophes join words ("Dog's" -> "dogs"), other punctuation separates them
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\'' || r == '’':
+			return -1
+		case r == '&':
+			return r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		default:
+			return ' '
+		}
+	}, name)
+	cleaned = strings.ReplaceAll(cleaned, "&", " & ")
+
+	var result normalizedName
+	fields := strings.Fields(cleaned)
+	for i, field := range fields {
+		// "No. 3" is just "3"
+		if field == "no" && i+1 < len(fields) && isNumber(fields[i+1]) {
+			continue
+		}
+		if expanded, ok := abbreviations[field]; ok {
+			field = expanded
+		}
+		if digits, ok := numberWords[field]; ok {
+			field = digits
+		}
+		if isNumber(field) {
+			// Strip leading zeros, "03" is "3"
+			n, _ := strconv.Atoi(field)
+			field = strconv.Itoa(n)
+			result.numbers = append(result.numbers, field)
+		}
+		result.tokens = append(result.tokens, field)
+	}
+	result.compact = strings.Join(result.tokens, "")
+	return result
+}
+
+// isNumber checks if a token is made up only of digits
+func isNumber(token string) bool {
+	if token == "" || len(token) > 9 {
+		return false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Similarity scores how alike two trail names are, from 0 (unrelated) to 1 (the same
+// once normalized). Names with different numbers, such as "Firelane 4" and "Firelane 5",
+// never match; a number on only one side, as in "Wildwood Trail #3", is just a difference.
+func Similarity(a, b string) float64 {
+	return similarity(normalize(a), normalize(b))
+}
+
+// similarity scores how alike two normalized trail names are
+func similarity(a, b normalizedName) float64 {
+	if a.compact == "" || b.compact == "" {
+		return 0
+	}
+	if a.compact == b.compact {
+		return 1
+	}
+	if len(a.numbers) > 0 && len(b.numbers) > 0 && strings.Join(a.numbers, " ") != strings.Join(b.numbers, " ") {
+		return 0
+	}
+
+	// Take the better of the character level score, which tolerates typos and
+	// spacing, and the word level score, which tolerates reordered words
+	return max(levenshteinRatio(a.compact, b.compact), tokenDice(a.tokens, b.tokens))
+}
+
+// levenshteinRatio returns 1 minus the edit distance between two strings, relative to the longer one
+func levenshteinRatio(a, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	longest := max(len(ar), len(br))
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(br)])/float64(longest)
+}
+
+// tokenDice returns the Dice coefficient of two sets of words
+func tokenDice(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, token := range a {
+		counts[token]++
+	}
+	shared := 0
+	for _, token := range b {
+		if counts[token] > 0 {
+			counts[token]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/toozej/trails-completionist/pkg/config"
+)
+
+// MatchOptions controls how GPX tracks are matched against OSM trails. The defaults
+// suit suburban trail networks; dense urban parks may need a smaller match distance
+// and higher minimum coverage, wide wilderness valleys a larger bounding box buffer.
+type MatchOptions struct {
+	BBoxBuffer          float64 // degrees added around each track when searching for nearby trails
+	MatchDistance       float64 // meters a trail may be from the track and still count as walked
+	SampleSpacing       float64 // meters between the points checked along each trail
+	MinCoverage         float64 // percentage of a trail's length which must be walked to match it
+	MinCoveredLength    float64 // meters walked which match a trail regardless of coverage
+	MaxResults          int     // most matches kept per GPX file, 0 keeps all of them
+	CompletionThreshold float64 // percentage of a trail GPX tracks must cover to complete it
+	Explain             bool    // record why each nearby trail was accepted or rejected
+	Workers             int     // GPX files processed at once, 0 uses one per CPU
+	CacheDir            string  // directory GPX file results are cached in, empty disables caching
+	Rebuild             bool    // discard cached results and process every GPX file again
+}
+
+// MatchOptionsFromConfig returns the match options set in the application configuration.
+// Results are cached in the user cache directory unless another directory is configured.
+func MatchOptionsFromConfig(conf config.Config) MatchOptions {
+	cacheDir := conf.ResultsCacheDir
+	if cacheDir == "" {
+		// Without a user cache directory, results simply aren't cached
+		cacheDir, _ = DefaultResultsCacheDir()
+	}
+
+	return MatchOptions{
+		BBoxBuffer:          conf.MatchBBoxBuffer,
+		MatchDistance:       conf.MatchDistance,
+		SampleSpacing:       conf.MatchSampleSpacing,
+		MinCoverage:         conf.MatchMinCoverage,
+		MinCoveredLength:    conf.MatchMinCoveredLength,
+		MaxResults:          conf.MatchMaxResults,
+		CompletionThreshold: conf.CompletionThreshold,
+		Workers:             conf.Workers,
+		CacheDir:            cacheDir,
+		Rebuild:             conf.Rebuild,
+	}
+}
+
+// Validate checks that the match options are usable
+func (o MatchOptions) Validate() error {
+	switch {
+	case o.BBoxBuffer < 0:
+		return fmt.Errorf("bounding box buffer must not be negative, got %g", o.BBoxBuffer)
+	case o.MatchDistance <= 0:
+		return fmt.Errorf("match distance must be positive, got %g", o.MatchDistance)
+	case o.SampleSpacing <= 0:
+		return fmt.Errorf("sample spacing must be positive, got %g", o.SampleSpacing)
+	case o.MinCoverage < 0 || o.MinCoverage > 100:
+		return fmt.Errorf("minimum coverage must be between 0 and 100, got %g", o.MinCoverage)
+	case o.MinCoveredLength < 0:
+		return fmt.Errorf("minimum covered length must not be negative, got %g", o.MinCoveredLength)
+	case o.MaxResults < 0:
+		return fmt.Errorf("maximum results must not be negative, got %d", o.MaxResults)
+	case o.Workers < 0:
+		return fmt.Errorf("workers must not be negative, got %d", o.Workers)
+	case o.CompletionThreshold <= 0 || o.CompletionThreshold > 100:
+		return fmt.Errorf("completion threshold must be above 0 and at most 100, got %g", o.CompletionThreshold)
+	}
+	return nil
+}
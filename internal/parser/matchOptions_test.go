@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/types"
+	"github.com/toozej/trails-completionist/pkg/osm"
+)
+
+func testMatchOptions() MatchOptions {
+	return MatchOptions{
+		BBoxBuffer:          0.005,
+		MatchDistance:       25,
+		SampleSpacing:       5,
+		MinCoverage:         50,
+		MinCoveredLength:    160,
+		MaxResults:          5,
+		CompletionThreshold: 90,
+	}
+}
+
+func TestMatchOptionsValidate(t *testing.T) {
+	if err := testMatchOptions().Validate(); err != nil {
+		t.Errorf("expected test options to be valid, got %v", err)
+	}
+
+	invalid := testMatchOptions()
+	invalid.SampleSpacing = 0
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected zero sample spacing to be rejected")
+	}
+}
+
+func TestMatchTrailsWithPoints_Explain(t *testing.T) {
+	// A north-south trail walked end to end, and an east-west trail only crossed
+	osmData := &osm.OSMData{
+		Nodes: map[int64]osm.OSMNode{
+			1: {ID: 1, Lat: 45.50, Lon: -122.70},
+			2: {ID: 2, Lat: 45.51, Lon: -122.70},
+			3: {ID: 3, Lat: 45.505, Lon: -122.71},
+			4: {ID: 4, Lat: 45.505, Lon: -122.69},
+		},
+	}
+	trails := []osm.Trail{
+		{ID: 10, Name: "Walked Trail", Type: "path", WayIDs: []int64{10}, Polylines: [][]int64{{1, 2}}},
+		{ID: 11, Name: "Crossed Trail", Type: "path", WayIDs: []int64{11}, Polylines: [][]int64{{3, 4}}},
+	}
+	track := line(45.50, -122.70, 45.51, -122.70, 50)
+
+	opts := testMatchOptions()
+	opts.Explain = true
+	matches, candidates, err := matchTrailsWithPoints(osmData, track, trails, opts)
+	if err != nil {
+		t.Fatalf("matchTrailsWithPoints returned error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Name != "Walked Trail" {
+		t.Fatalf("expected only the walked trail to match, got %+v", matches)
+	}
+	if len(candidates) != 2 || !candidates[0].Accepted || candidates[1].Accepted {
+		t.Fatalf("expected one accepted and one rejected candidate, got %+v", candidates)
+	}
+
+	// Allowing any walked length to match accepts the crossed trail, unless the results are limited
+	opts.MinCoveredLength = 0
+	opts.MaxResults = 1
+	matches, candidates, err = matchTrailsWithPoints(osmData, track, trails, opts)
+	if err != nil {
+		t.Fatalf("matchTrailsWithPoints returned error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected results to be limited to one match, got %+v", matches)
+	}
+	expected := []types.TrailCandidate{
+		{Accepted: true, Reason: "at least 50% covered"},
+		{Accepted: false, Reason: "not among the best 1 matches"},
+	}
+	for i, candidate := range candidates {
+		if candidate.Accepted != expected[i].Accepted || candidate.Reason != expected[i].Reason {
+			t.Errorf("candidate %d: got %v %q, expected %v %q", i, candidate.Accepted, candidate.Reason, expected[i].Accepted, expected[i].Reason)
+		}
+	}
+
+	// Without explaining, no candidates are recorded
+	opts.Explain = false
+	if _, candidates, _ = matchTrailsWithPoints(osmData, track, trails, opts); candidates != nil {
+		t.Errorf("expected no candidates without explain, got %+v", candidates)
+	}
+}
@@ -2,14 +2,53 @@ package parser
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/toozej/trails-completionist/internal/types"
 )
 
+// ChecklistVersion is the version of the checklist grammar written by the generator.
+//
+// A version 2 checklist starts with a version comment, then a title and a summary of
+// progress (ignored when reading), then a section per park with a bullet per trail. Each trail's details are "key: value" sub-bullets,
+// written in this order and each only when set:
+//
+//	<!-- trails-completionist checklist v2 -->
+//	# PDX Trails Completionist
+//	## Park 1
+//	- Trail A
+//	    - type: Trail
+//	    - length: 7.3 miles             (or km, mi or ft)
+//	    - url: https://example.com/trail-a
+//	    - park: Park 1                  (unlisted trails only, which have no park heading)
+//	    - osm: way/123456
+//	    - covered: 95.2%
+//	    - remaining: 2.1-2.4 mi, part 2: 0.0-0.3 mi
+//	    - completed: 10/10/2023         ("yes" if the day is unknown)
+//	    - hiked: 2 times, last on 10/10/2023
+//	        - 09/01/2023 tracks/2023-09-01.gpx
+//	        - 10/10/2023                (a hike recorded by hand)
+//	    - tags: loop, dogs
+//	    - note: Bring water             (repeated for each note)
+//	## Unlisted
+//
+// Dates are MM/DD/YYYY or ISO 8601. The "hiked" summary is derived from the hikes under
+// it. Any other sub-bullet is kept as a note, with a warning if it looks like an unknown
+// key. Checklists without a version comment are version 1, which has the same layout
+// with bare values ("- Trail", "- 7.3 miles", "- Completed 10/10/2023", "- Found in Park 1").
+const ChecklistVersion = 2
+
+// unlistedHeading starts the section of trails found in GPX tracks but missing from the raw input list
+const unlistedHeading = "## Unlisted"
+
+// checklistVersionRegex matches the version comment at the top of a checklist
+var checklistVersionRegex = regexp.MustCompile(`^<!-- trails-completionist checklist v(\d+) -->$`)
+
 // Extract trail information from file contents
 func extractTrailInfoFromChecklist(file *os.File) ([]types.Trail, error) {
 	var trails []types.Trail
@@ -20,92 +59,169 @@ func extractTrailInfoFromChecklist(file *os.File) ([]types.Trail, error) {
 	// scan through file looking for trail info
 	var currentTrail types.Trail
 	var currentPark string
+	var currentUnlisted bool
+	var lineNumber int
+	version := 1
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNumber++
 
 		switch {
 		case line == "":
 			continue
+		case checklistVersionRegex.MatchString(line):
+			version, _ = strconv.Atoi(checklistVersionRegex.FindStringSubmatch(line)[1])
+			if version > ChecklistVersion {
+				return nil, fmt.Errorf("%s:%d: checklist version %d is newer than the supported version %d", file.Name(), lineNumber, version, ChecklistVersion)
+			}
+		case line == unlistedHeading:
+			// unlisted trails record their park in a sub-bullet instead
+			currentPark = ""
+			currentUnlisted = true
 		case strings.HasPrefix(line, "## "):
 			currentPark = parseTrailParkFromChecklist(line)
+			currentUnlisted = false
 		case strings.HasPrefix(line, "- "):
 			if currentTrail.Name != "" {
 				trails = append(trails, currentTrail)
 			}
 			currentTrail = types.Trail{
-				Name: parseTrailNameFromChecklist(line),
-				Park: currentPark,
+				Name:     parseTrailNameFromChecklist(line),
+				Park:     currentPark,
+				Unlisted: currentUnlisted,
 			}
+		case currentTrail.Name == "":
+			// the title, or anything else before the first trail
+			continue
+		case strings.HasPrefix(line, "        - "):
+			completion, err := parseTrailCompletionFromChecklist(line)
+			if err != nil {
+				fmt.Printf("Warning: %s:%d: %v\n", file.Name(), lineNumber, err)
+				continue
+			}
+			currentTrail.Completions = append(currentTrail.Completions, completion)
 		case strings.HasPrefix(line, "    - "):
-			switch {
-			case strings.Contains(line, "Connector") || strings.Contains(line, "Trail"):
-				currentTrail.Type = parseTrailTypeFromChecklist(line)
-			case strings.Contains(line, "miles"):
-				currentTrail.Length = parseTrailLengthFromChecklist(line)
-			case strings.Contains(line, "Completed"):
-				currentTrail.Completed = parseTrailCompletedFromChecklist(line)
-				currentTrail.CompletionDate = parseTrailCompletionDateFromChecklist(line)
-			case strings.Contains(line, "http"):
-				currentTrail.URL = parseTrailURLFromChecklist(line)
+			item := strings.TrimPrefix(line, "    - ")
+			var err error
+			if version >= 2 {
+				err = parseTrailFieldFromChecklist(&currentTrail, item)
+			} else {
+				err = parseLegacyTrailFieldFromChecklist(&currentTrail, item)
+			}
+			if err != nil {
+				fmt.Printf("Warning: %s:%d: %v\n", file.Name(), lineNumber, err)
 			}
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return trails, err
+	}
+	if currentTrail.Name != "" {
+		trails = append(trails, currentTrail)
+	}
 
 	return trails, nil
 }
 
-func parseTrailNameFromChecklist(input string) string {
-	// Regular expression to parse trail park
-	re := regexp.MustCompile(`^-\s*(.*$)$`)
-
-	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
+// checklistKeyRegex matches a "key: value" sub-bullet, or a key with nothing after it
+var checklistKeyRegex = regexp.MustCompile(`^([a-z]+):(?: (.*))?$`)
 
-	var trailName string
-	if len(match) == 2 {
-		trailName = match[1]
-	} else {
-		trailName = ""
+// parseTrailFieldFromChecklist parses a version 2 "key: value" sub-bullet into the trail
+func parseTrailFieldFromChecklist(trail *types.Trail, item string) error {
+	match := checklistKeyRegex.FindStringSubmatch(item)
+	if match == nil {
+		trail.Notes = append(trail.Notes, item)
+		return nil
 	}
+	key, value := match[1], match[2]
 
-	return trailName
+	var err error
+	switch key {
+	case "type":
+		trail.Type = value
+	case "length":
+		trail.Length, err = types.ParseDistance(value)
+	case "url":
+		trail.URL = value
+	case "park":
+		trail.Park = value
+	case "osm":
+		trail.OSMType, trail.OSMId, err = parseTrailOSMIdFromChecklist(value)
+	case "covered":
+		trail.PercentComplete, err = parseTrailPercentCompleteFromChecklist(value)
+	case "remaining":
+		trail.UncoveredSegments, err = parseTrailUncoveredSegmentsFromChecklist(value)
+	case "completed":
+		trail.Completed = true
+		if value != "yes" {
+			trail.CompletionDate, err = parseTrailCompletionDateFromChecklist(value)
+		}
+	case "hiked":
+		// hike count and last date are derived from the completions which follow
+	case "tags":
+		trail.Tags = parseTrailTagsFromChecklist(value)
+	case "note":
+		trail.Notes = append(trail.Notes, value)
+	default:
+		trail.Notes = append(trail.Notes, item)
+		return fmt.Errorf("unknown checklist key %q, kept as a note", key)
+	}
+	return err
 }
 
-func parseTrailTypeFromChecklist(input string) string {
-	// Regular expression to parse trail type and length
-	re := regexp.MustCompile(`^\s{4}-\s(Connector|Trail)$`)
-
-	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
-
-	var trailType string
-	if len(match) == 2 {
-		trailType = match[1]
-	} else {
-		trailType = ""
+// parseLegacyTrailFieldFromChecklist parses a version 1 sub-bullet, which has a bare value, into the trail
+func parseLegacyTrailFieldFromChecklist(trail *types.Trail, item string) error {
+	var err error
+	switch {
+	case trail.Unlisted && strings.HasPrefix(item, "Found in "):
+		trail.Park = strings.TrimPrefix(item, "Found in ")
+	case trail.Unlisted && strings.HasPrefix(item, "OSM "):
+		trail.OSMType, trail.OSMId, err = parseTrailOSMIdFromChecklist(strings.TrimPrefix(item, "OSM "))
+	case strings.HasPrefix(item, "Hiked "):
+		// hike count and last date are derived from the completions which follow
+	case strings.HasSuffix(item, "% covered"):
+		trail.PercentComplete, err = parseTrailPercentCompleteFromChecklist(strings.TrimSuffix(item, " covered"))
+	case strings.HasPrefix(item, "Remaining "):
+		trail.UncoveredSegments, err = parseTrailUncoveredSegmentsFromChecklist(strings.TrimPrefix(item, "Remaining "))
+	case checklistLengthRegex.MatchString(item):
+		trail.Length, err = types.ParseDistance(item)
+	case item == "Connector" || item == "Trail":
+		trail.Type = item
+	case item == "Completed" || strings.HasPrefix(item, "Completed "):
+		trail.Completed = true
+		if d := strings.TrimSpace(strings.TrimPrefix(item, "Completed")); d != "" {
+			trail.CompletionDate, err = parseTrailCompletionDateFromChecklist(d)
+		}
+	case strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://"):
+		trail.URL = item
+	default:
+		// anything else was added by hand, and is kept as a note
+		trail.Notes = append(trail.Notes, item)
 	}
-
-	return trailType
+	return err
 }
 
-func parseTrailLengthFromChecklist(input string) string {
-	// Regular expression to parse trail type and length
-	re := regexp.MustCompile(`^\s{4}-\s(\d+(?:\.\d+)?)\s+miles$`)
+func parseTrailNameFromChecklist(input string) string {
+	// Regular expression to parse trail park
+	re := regexp.MustCompile(`^-\s*(.*$)$`)
 
 	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
 	match := re.FindStringSubmatch(input)
 
-	var trailLength string
+	var trailName string
 	if len(match) == 2 {
-		trailLength = match[1]
+		trailName = match[1]
 	} else {
-		trailLength = "NaN"
+		trailName = ""
 	}
 
-	return trailLength
+	return trailName
 }
 
+// checklistLengthRegex matches a version 1 trail length, such as "7.3 miles" or "11.7 km"
+var checklistLengthRegex = regexp.MustCompile(`^\d+(?:\.\d+)?\s*[a-zA-Z]+$`)
+
 func parseTrailParkFromChecklist(input string) string {
 	// Regular expression to parse trail park
 	re := regexp.MustCompile(`^##\s*(.*$)$`)
@@ -123,71 +239,92 @@ func parseTrailParkFromChecklist(input string) string {
 	return trailPark
 }
 
-func parseTrailCompletedFromChecklist(input string) bool {
-	// Regular expression to parse trail completed
-	re := regexp.MustCompile(`^\s{4}-\s{1}(?i)Completed`)
+// checklistDateLayouts are the valid checklist date layouts
+// date format must be MM/DD/YYYY, MM/DD/YY, M/D/YYYY, M/D/YY, or ISO 8601 (YYYY-MM-DD, with or without a time)
+var checklistDateLayouts = []string{"01/02/2006", "01/02/06", "1/2/2006", "1/2/06", "2006-01-02", time.RFC3339}
 
-	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
+// ParseChecklistDate parses a checklist date in any of the checklistDateLayouts, returning its day
+func ParseChecklistDate(input string) (time.Time, error) {
+	for _, layout := range checklistDateLayouts {
+		parsedDate, err := time.Parse(layout, input)
+		if err == nil {
+			return types.Day(parsedDate), nil
+		}
+	}
 
-	var trailCompleted bool
-	if len(match) == 1 {
-		trailCompleted = true
-	} else {
-		trailCompleted = false
+	return time.Time{}, fmt.Errorf("invalid date %q, expected MM/DD/YYYY or YYYY-MM-DD", input)
+}
+
+func parseTrailCompletionDateFromChecklist(input string) (time.Time, error) {
+	completionDate, err := ParseChecklistDate(input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid completion date: %w", err)
 	}
 
-	return trailCompleted
+	return completionDate, nil
 }
 
-func parseTrailCompletionDateFromChecklist(input string) string {
-	// Parse trail completion date using time.Parse()
+func parseTrailCompletionFromChecklist(input string) (types.Completion, error) {
+	// remove any non-completion junk from input, leaving the date and source file
+	s := strings.TrimPrefix(input, "        - ")
+	d, sourceFile, _ := strings.Cut(s, " ")
+
+	hikeDate, err := ParseChecklistDate(d)
+	if err != nil {
+		return types.Completion{}, fmt.Errorf("invalid hike date: %w", err)
+	}
 
-	// remove any non-date junk from input
-	d := strings.TrimPrefix(input, "    - Completed ")
+	return types.Completion{Date: hikeDate, SourceFile: sourceFile}, nil
+}
 
-	// Define the valid layouts
-	// date format must be MM/DD/YYYY, MM/DD/YY, M/D/YYYY, or M/D/YY
-	layouts := []string{"01/02/2006", "01/02/06", "1/2/2006", "1/2/06"}
+func parseTrailOSMIdFromChecklist(input string) (string, int64, error) {
+	// Regular expression to parse trail OSM type and ID
+	re := regexp.MustCompile(`^(way|relation)/(\d+)$`)
 
-	defaultDate := "01/01/1970"
-	var parsedDate time.Time
-	var err error
-	var trailCompletionDate string
+	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
+	match := re.FindStringSubmatch(input)
 
-	// Try parsing the date-like input d using the layouts
-	for _, layout := range layouts {
-		parsedDate, err = time.Parse(layout, d)
-		if err == nil {
-			break
-		}
+	if len(match) != 3 {
+		return "", 0, fmt.Errorf("invalid OSM ID %q, expected way/ID or relation/ID", input)
 	}
-
-	// If no valid date is found, use the default date
+	osmId, err := strconv.ParseInt(match[2], 10, 64)
 	if err != nil {
-		parsedDate, _ = time.Parse(layouts[0], defaultDate)
+		return "", 0, fmt.Errorf("invalid OSM ID %q: %w", input, err)
 	}
+	return match[1], osmId, nil
+}
 
-	trailCompletionDate = parsedDate.Format(layouts[0])
+func parseTrailPercentCompleteFromChecklist(input string) (float64, error) {
+	percentComplete, err := strconv.ParseFloat(strings.TrimSuffix(input, "%"), 64)
+	if err != nil || !strings.HasSuffix(input, "%") {
+		return 0, fmt.Errorf("invalid coverage %q, expected a percentage", input)
+	}
 
-	return trailCompletionDate
+	return percentComplete, nil
 }
 
-func parseTrailURLFromChecklist(input string) string {
-	// Regular expression to parse trail URL
-	re := regexp.MustCompile(`^\s{4}-\s{1}(http.*)$`)
+func parseTrailUncoveredSegmentsFromChecklist(input string) ([]types.TrailSegment, error) {
+	var segments []types.TrailSegment
+	for _, part := range strings.Split(input, ", ") {
+		segment, err := types.ParseTrailSegment(part)
+		if err != nil {
+			return segments, err
+		}
+		segments = append(segments, segment)
+	}
 
-	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
+	return segments, nil
+}
 
-	var trailURL string
-	if len(match) == 2 {
-		trailURL = match[1]
-	} else {
-		trailURL = ""
+func parseTrailTagsFromChecklist(input string) []string {
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
 	}
 
-	return trailURL
+	return tags
 }
 
 func ParseTrailsFromChecklist(filename string) ([]types.Trail, error) {
@@ -195,6 +332,7 @@ func ParseTrailsFromChecklist(filename string) ([]types.Trail, error) {
 	if err != nil {
 		return []types.Trail{}, err
 	}
+	defer f.Close()
 
 	trails, err := extractTrailInfoFromChecklist(f)
 	if err != nil {
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseChecklistDate(t *testing.T) {
+	want := time.Date(2023, time.October, 28, 0, 0, 0, 0, time.UTC)
+	for _, input := range []string{"10/28/2023", "10/28/23", "2023-10-28", "2023-10-28T09:30:00-07:00"} {
+		got, err := ParseChecklistDate(input)
+		if err != nil {
+			t.Errorf("ParseChecklistDate(%q) returned error: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseChecklistDate(%q) = %v, want %v", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "28/10/2023", "October 28"} {
+		if _, err := ParseChecklistDate(input); err == nil {
+			t.Errorf("ParseChecklistDate(%q) expected an error", input)
+		}
+	}
+}
+
+func TestParseTrailsFromChecklist_InvalidDates(t *testing.T) {
+	checklist := filepath.Join(t.TempDir(), "checklist.md")
+	content := `# PDX Trails Completionist
+## Forest Park
+- Wildwood Trail
+    - Trail
+    - 30.2 miles
+    - Completed sometime
+    - Hiked 2 times, last on 2024-06-01
+        - 2024-05-01 a.gpx
+        - yesterday b.gpx
+- Maple Trail
+    - Trail
+    - 4.6 miles
+`
+	if err := os.WriteFile(checklist, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	trails, err := ParseTrailsFromChecklist(checklist)
+	if err != nil {
+		t.Fatalf("ParseTrailsFromChecklist returned error: %v", err)
+	}
+	if len(trails) == 0 {
+		t.Fatal("expected trails to be parsed")
+	}
+
+	// An unparseable date leaves the trail completed on an unknown day, rather than in 1970
+	wildwood := trails[0]
+	if !wildwood.Completed || !wildwood.CompletionDate.IsZero() {
+		t.Errorf("expected Wildwood Trail completed with no date, got %v %v", wildwood.Completed, wildwood.CompletionDate)
+	}
+	if wildwood.HikeCount() != 1 || !wildwood.LastHiked().Equal(time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected only the valid hike to be kept, got %v", wildwood.Completions)
+	}
+}
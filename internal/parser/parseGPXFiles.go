@@ -1,12 +1,16 @@
 package parser
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -21,7 +25,7 @@ import (
 func OutputResults(results []types.TrailResult, format string) {
 	switch format {
 	case "csv":
-		fmt.Println("Filename,TravelDate,TrailName,TrailType,Similarity,OSMID")
+		fmt.Println("Filename,TravelDate,TrailName,TrailType,Length,Coverage,OSMID")
 		for _, result := range results {
 			for _, match := range result.Matches {
 				fmt.Printf("%s,%s,%s,%s,%.1f,%.2f,%d\n",
@@ -30,7 +34,7 @@ func OutputResults(results []types.TrailResult, format string) {
 					match.Name,
 					match.Type,
 					match.Length,
-					match.Similarity*100,
+					match.Coverage,
 					match.OSMId)
 			}
 		}
@@ -44,8 +48,8 @@ func OutputResults(results []types.TrailResult, format string) {
 			} else {
 				fmt.Println("Trail matches:")
 				for i, match := range result.Matches {
-					fmt.Printf("  %d. %s (%.1f%% match, Type: %s, Length: %.1f, OSM ID: %d)\n",
-						i+1, match.Name, match.Similarity*100, match.Type, match.Length, match.OSMId)
+					fmt.Printf("  %d. %s (%.1f%% covered, %.1f of %.1f miles, Type: %s, OSM ID: %s/%d)\n",
+						i+1, match.Name, match.Coverage, match.CoveredLength, match.Length, match.Type, match.OSMType, match.OSMId)
 				}
 			}
 			fmt.Println(strings.Repeat("-", 40))
@@ -53,115 +57,285 @@ func OutputResults(results []types.TrailResult, format string) {
 	}
 }
 
-// ParseTrailsFromTrackFiles processes the provided track files and returns the found trails
-func ParseTrailsFromTrackFiles(trackFiles string, recursive bool, osmData *osm.OSMData) ([]types.Trail, error) {
-	foundTrailResults, err := processDirectory(trackFiles, recursive, osmData)
+// ExplainResults prints every trail considered for each GPX file, and why it was
+// accepted or rejected as a match
+func ExplainResults(results []types.TrailResult, opts MatchOptions) {
+	fmt.Printf("Matching trails within %.0fm of each track, checked every %.0fm, searching %g degrees around it\n",
+		opts.MatchDistance, opts.SampleSpacing, opts.BBoxBuffer)
+	for _, result := range results {
+		fmt.Printf("\nFile: %s\n", result.Filename)
+		if len(result.Candidates) == 0 {
+			fmt.Println("  No trails nearby")
+			continue
+		}
+		for _, candidate := range result.Candidates {
+			verdict := "rejected"
+			if candidate.Accepted {
+				verdict = "accepted"
+			}
+			match := candidate.Match
+			fmt.Printf("  %s %s (%s/%d): %.1f%% covered, %.1f of %.1f miles, %s\n",
+				verdict, match.Name, match.OSMType, match.OSMId, match.Coverage, match.CoveredLength, match.Length, candidate.Reason)
+		}
+	}
+}
+
+// ParseTrailsFromTrackFiles processes the provided track files and returns the found trails.
+// Trails are marked completed once GPX tracks cover at least opts.CompletionThreshold percent of them.
+// If opts.Explain is set, the reason each nearby trail was accepted or rejected is printed.
+// Files are processed concurrently, and cancelling ctx stops processing early. Results
+// are cached in opts.CacheDir, so unchanged files are only processed again if opts.Rebuild is set.
+func ParseTrailsFromTrackFiles(ctx context.Context, trackFiles string, recursive bool, osmData *osm.OSMData, opts MatchOptions) ([]types.Trail, error) {
+	if osmData == nil {
+		return nil, fmt.Errorf("OSM region data is required to match trails in track files")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid match options: %w", err)
+	}
+
+	// Results can only be cached against OSM data which can be identified across runs
+	var cache *resultsCache
+	if opts.CacheDir != "" && osmData.Checksum() != "" {
+		var err error
+		if cache, err = openResultsCache(opts.CacheDir, osmData.Checksum(), opts, opts.Rebuild); err != nil {
+			fmt.Printf("Warning: Not caching GPX results: %v\n", err)
+		}
+	}
+
+	foundTrailResults, err := processDirectory(ctx, trackFiles, recursive, osmData, opts, cache)
 	if err != nil {
 		return nil, fmt.Errorf("error processing track files: %w", err)
 	}
 	if len(foundTrailResults) == 0 {
 		return nil, fmt.Errorf("no GPX files found in %s", trackFiles)
 	}
+	if opts.Explain {
+		ExplainResults(foundTrailResults, opts)
+	}
 
 	// convert from []types.TrailResult to []types.Trail
-	trails, err := convertTrailResultsToTrails(foundTrailResults)
+	trails, err := convertTrailResultsToTrails(foundTrailResults, opts.CompletionThreshold)
 	if err != nil {
 		return nil, fmt.Errorf("error converting trail results to trails: %w", err)
 	}
 	return trails, nil
 }
 
-// convertTrailResultsToTrails converts a slice of TrailResult to a slice of Trail
-// This function assumes that the Trail is completed and sets the completion date.
-func convertTrailResultsToTrails(results []types.TrailResult) ([]types.Trail, error) {
-	var trails []types.Trail
+// minUncoveredMiles is the shortest uncovered stretch of a trail worth reporting,
+// shorter gaps are usually just GPS noise
+const minUncoveredMiles = 0.05
+
+// trailProgress collects the coverage of one OSM trail across all GPX files
+type trailProgress struct {
+	match          types.TrailMatch
+	segments       []types.TrailSegment
+	completionDate time.Time
+	completions    []types.Completion
+}
+
+// convertTrailResultsToTrails converts a slice of TrailResult to a slice of Trail,
+// combining the coverage of each trail across all of the results. Results are
+// processed in travel date order, so a trail's completion date is the date of
+// the hike which took its coverage to completionThreshold percent. Its completions
+// list, earliest first, that hike and every other hike which alone covered
+// completionThreshold percent of it, so partial passes aren't counted.
+func convertTrailResultsToTrails(results []types.TrailResult, completionThreshold float64) ([]types.Trail, error) {
 	fmt.Printf("convertTrailResultsToTrails converting %d results into Trails\n", len(results))
-	for _, result := range results {
-		switch len(result.Matches) {
-		case 0:
+
+	sorted := append([]types.TrailResult{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TravelDate.Before(sorted[j].TravelDate)
+	})
+
+	progressByTrail := make(map[string]*trailProgress)
+	var order []string
+	for _, result := range sorted {
+		if len(result.Matches) == 0 {
 			fmt.Printf("No matches found for file %s\n", result.Filename)
-		case 1:
-			// Only one match, use it
-			trail := types.Trail{
-				Name:           result.Matches[0].Name,
-				Park:           "",
-				Type:           convertOSMTrailTypeToTrailType(result.Matches[0].Type),
-				Length:         fmt.Sprintf("%.1f", result.Matches[0].Length),
-				URL:            "",
-				Completed:      true,
-				CompletionDate: result.TravelDate.Format("01/02/2006"),
-			}
-			if log.GetLevel() == log.DebugLevel {
-				fmt.Printf("Added trail %s from filename %s\n", trail.Name, result.Filename)
+			continue
+		}
+
+		for _, match := range result.Matches {
+			key := fmt.Sprintf("%s/%d", match.OSMType, match.OSMId)
+			progress, exists := progressByTrail[key]
+			if !exists {
+				progress = &trailProgress{match: match}
+				progressByTrail[key] = progress
+				order = append(order, key)
 			}
-			trails = append(trails, trail)
-		default:
-			// Multiple matches, use all of them
-			for _, match := range result.Matches {
-				// Check if the trail already exists in the list, and if so, skip it
-				exists := false
-				for _, t := range trails {
-					if strings.EqualFold(t.Name, match.Name) {
-						exists = true
-						break
-					}
-				}
-				if exists {
-					continue
-				}
 
-				// Create a new trail from the match
-				trail := types.Trail{
-					Name:           match.Name,
-					Park:           "",
-					Type:           convertOSMTrailTypeToTrailType(match.Type),
-					Length:         fmt.Sprintf("%.1f", match.Length),
-					URL:            "",
-					Completed:      true,
-					CompletionDate: result.TravelDate.Format("01/02/2006"),
-				}
-				if log.GetLevel() == log.DebugLevel {
-					fmt.Printf("Added trail %s from filename %s\n", trail.Name, result.Filename)
-				}
-				trails = append(trails, trail)
+			completes := percentOf(mergeSegments(match.CoveredSegments), match.PolylineLengths) >= completionThreshold
+			progress.segments = mergeSegments(append(progress.segments, match.CoveredSegments...))
+			if progress.completionDate.IsZero() && percentCovered(progress) >= completionThreshold {
+				progress.completionDate = result.TravelDate
+				completes = true
+			}
+			if completes {
+				progress.completions = append(progress.completions, types.Completion{
+					Date:       types.Day(result.TravelDate),
+					SourceFile: result.Filename,
+				})
+			}
 
+			if log.GetLevel() == log.DebugLevel {
+				fmt.Printf("Added coverage of trail %s from filename %s\n", match.Name, result.Filename)
 			}
 		}
 	}
+
+	var trails []types.Trail
+	for _, key := range order {
+		progress := progressByTrail[key]
+		trail := types.Trail{
+			Name:              progress.match.Name,
+			Park:              progress.match.Park,
+			Type:              convertOSMTrailTypeToTrailType(progress.match.Type),
+			Length:            types.Miles(progress.match.Length),
+			URL:               "",
+			Completed:         !progress.completionDate.IsZero(),
+			PercentComplete:   math.Round(percentCovered(progress)*10) / 10,
+			UncoveredSegments: uncoveredSegments(progress.segments, progress.match.PolylineLengths, minUncoveredMiles),
+			Completions:       progress.completions,
+			OSMId:             progress.match.OSMId,
+			OSMType:           progress.match.OSMType,
+		}
+		if trail.Completed {
+			trail.CompletionDate = types.Day(progress.completionDate)
+		}
+		trails = append(trails, trail)
+	}
 	return trails, nil
 }
 
-// processDirectory processes all GPX files in a directory
-func processDirectory(dirPath string, recursive bool, osmData *osm.OSMData) ([]types.TrailResult, error) {
-	var results []types.TrailResult
+// percentCovered returns the percentage of a trail's length covered so far
+func percentCovered(progress *trailProgress) float64 {
+	return percentOf(progress.segments, progress.match.PolylineLengths)
+}
+
+// percentOf returns the percentage of a trail's polylines covered by merged covered stretches
+func percentOf(merged []types.TrailSegment, polylineLengths []float64) float64 {
+	total := 0.0
+	for _, length := range polylineLengths {
+		total += length
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Min(100, coveredLength(merged)/total*100)
+}
+
+// findGPXFiles returns the GPX files in a directory, in lexical walk order
+func findGPXFiles(dirPath string, recursive bool) ([]string, error) {
+	var paths []string
 
-	walkFn := func(path string, info os.FileInfo, err error) error {
+	walkFn := func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Skip directories if not recursive
-		if info.IsDir() && !recursive && path != dirPath {
+		if entry.IsDir() && !recursive && path != dirPath {
 			return filepath.SkipDir
 		}
 
 		// Process only .gpx files
-		if !info.IsDir() && filepath.Ext(path) == ".gpx" {
-			fmt.Printf("Processing %s...\n", path)
-			result, err := processGPXFile(path, osmData)
-			if err != nil {
-				fmt.Printf("  Warning: Could not process %s: %v\n", path, err)
-				return nil // Continue with other files
-			}
-			results = append(results, result)
+		if !entry.IsDir() && filepath.Ext(path) == ".gpx" {
+			paths = append(paths, path)
 		}
 		return nil
 	}
 
-	if err := filepath.Walk(dirPath, walkFn); err != nil {
+	if err := filepath.WalkDir(dirPath, walkFn); err != nil {
 		return nil, fmt.Errorf("error walking directory: %w", err)
 	}
+	return paths, nil
+}
+
+// fileResult is the outcome of processing one GPX file, by its position in the walk order
+type fileResult struct {
+	index  int
+	result types.TrailResult
+	cached bool
+	err    error
+}
+
+// processDirectory processes all GPX files in a directory, using a pool of opts.Workers
+// goroutines which share the read-only OSM data. Results are returned in walk order
+// however the files finish, and processing stops early if ctx is cancelled. Unchanged
+// files are loaded from cache instead, unless it is nil.
+func processDirectory(ctx context.Context, dirPath string, recursive bool, osmData *osm.OSMData, opts MatchOptions, cache *resultsCache) ([]types.TrailResult, error) {
+	paths, err := findGPXFiles(dirPath, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(paths))
+	fmt.Printf("Processing %d GPX files with %d workers...\n", len(paths), workers)
+
+	jobs := make(chan int)
+	done := make(chan fileResult)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for index := range jobs {
+				result, cached, err := processGPXFileCached(cache, paths[index], osmData, opts)
+				done <- fileResult{index: index, result: result, cached: cached, err: err}
+			}
+		})
+	}
+
+	// Hand out files until they run out or processing is cancelled
+	go func() {
+		defer close(jobs)
+		for index := range paths {
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	processed := make([]*types.TrailResult, len(paths))
+	count, cachedCount := 0, 0
+	for file := range done {
+		count++
+		if file.err != nil {
+			fmt.Printf("[%d/%d] Warning: Could not process %s: %v\n", count, len(paths), paths[file.index], file.err)
+			continue // Continue with other files
+		}
+		processed[file.index] = &file.result
+		if file.cached {
+			cachedCount++
+			fmt.Printf("[%d/%d] Loaded cached results for %s\n", count, len(paths), paths[file.index])
+		} else {
+			fmt.Printf("[%d/%d] Processed %s\n", count, len(paths), paths[file.index])
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("processing cancelled after %d of %d files: %w", count, len(paths), err)
+	}
+	if cache != nil {
+		fmt.Printf("%d of %d GPX files were unchanged and loaded from the results cache\n", cachedCount, len(paths))
+	}
 
+	var results []types.TrailResult
+	for _, result := range processed {
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
 	return results, nil
 }
 
@@ -176,36 +350,45 @@ func convertOSMTrailTypeToTrailType(osmType string) string {
 		return "Trail"
 	case "trail":
 		return "Trail"
+	case "bridleway":
+		return "Trail"
+	case "steps":
+		return "Trail"
+	case "hiking", "foot":
+		// route relations
+		return "Trail"
 	default:
 		return "Unknown"
 	}
 }
 
-// calculateTrailLength calculates the total length of a trail in miles
-func calculateTrailLength(points []types.Point) float64 {
+// calculateTrailLength calculates the total length of a trail's segments in miles
+func calculateTrailLength(segments [][]types.Point) float64 {
 	const earthRadiusMiles = 3958.8 // Earth's radius in miles
 
 	totalDistance := 0.0
-	for i := 1; i < len(points); i++ {
-		lat1, lon1 := points[i-1].Lat, points[i-1].Lon
-		lat2, lon2 := points[i].Lat, points[i].Lon
-
-		// Convert degrees to radians
-		lat1Rad := lat1 * math.Pi / 180
-		lat2Rad := lat2 * math.Pi / 180
-		lon1Rad := lon1 * math.Pi / 180
-		lon2Rad := lon2 * math.Pi / 180
-
-		dLat := lat2Rad - lat1Rad
-		dLon := lon2Rad - lon1Rad
-
-		a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-			math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
-		c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-		// Distance between two points
-		distance := earthRadiusMiles * c
-		totalDistance += distance
+	for _, points := range segments {
+		for i := 1; i < len(points); i++ {
+			lat1, lon1 := points[i-1].Lat, points[i-1].Lon
+			lat2, lon2 := points[i].Lat, points[i].Lon
+
+			// Convert degrees to radians
+			lat1Rad := lat1 * math.Pi / 180
+			lat2Rad := lat2 * math.Pi / 180
+			lon1Rad := lon1 * math.Pi / 180
+			lon2Rad := lon2 * math.Pi / 180
+
+			dLat := lat2Rad - lat1Rad
+			dLon := lon2Rad - lon1Rad
+
+			a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+				math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+			c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+			// Distance between two points
+			distance := earthRadiusMiles * c
+			totalDistance += distance
+		}
 	}
 
 	// Round to the nearest tenth of a mile
@@ -213,7 +396,7 @@ func calculateTrailLength(points []types.Point) float64 {
 }
 
 // processGPXFile processes a single GPX file
-func processGPXFile(filePath string, osmData *osm.OSMData) (types.TrailResult, error) {
+func processGPXFile(filePath string, osmData *osm.OSMData, opts MatchOptions) (types.TrailResult, error) {
 	result := types.TrailResult{
 		Filename: filePath,
 	}
@@ -286,7 +469,7 @@ func processGPXFile(filePath string, osmData *osm.OSMData) (types.TrailResult, e
 	}
 
 	// Calculate bounding box with buffer
-	bbox := calculateBoundingBox(trackPoints, 0.005) // ~500m buffer
+	bbox := calculateBoundingBox(trackPoints, opts.BBoxBuffer)
 
 	// Query for trails in the area
 	trails, err := queryTrailsFromOSM(osmData, bbox)
@@ -295,12 +478,13 @@ func processGPXFile(filePath string, osmData *osm.OSMData) (types.TrailResult, e
 	}
 
 	// Match trails
-	matches, err := matchTrailsWithPoints(osmData, trackPoints, trails)
+	matches, candidates, err := matchTrailsWithPoints(osmData, trackPoints, trails, opts)
 	if err != nil {
 		return result, fmt.Errorf("error matching trails: %w", err)
 	}
 
 	result.Matches = matches
+	result.Candidates = candidates
 	return result, nil
 }
 
@@ -328,175 +512,176 @@ func calculateBoundingBox(points []types.Point, buffer float64) [4]float64 {
 func queryTrailsFromOSM(osmData *osm.OSMData, bbox [4]float64) ([]osm.Trail, error) {
 	var trails []osm.Trail
 
-	for id, way := range osmData.Ways {
-		// Skip ways that don't overlap with our bounding box
-		if !osm.Overlaps(way.BBox, bbox) {
-			continue
-		}
-
-		// Check if this is a trail/path based on tags
-		isTrail := false
-		trailType := ""
-		name := ""
+	// Named hiking route relations are treated as one logical trail, so their
+	// member ways are not reported as trails of their own, see IncludeTrailWay.
+	// Relations are checked in ID order, like ways, so trails are always found
+	// in the same order.
+	relationIDs := make([]int64, 0, len(osmData.Relations))
+	for id := range osmData.Relations {
+		relationIDs = append(relationIDs, id)
+	}
+	sort.Slice(relationIDs, func(i, j int) bool { return relationIDs[i] < relationIDs[j] })
 
-		// Check highway tag for trail types
-		if val, ok := way.Tags["highway"]; ok {
-			if val == "path" || val == "footway" || val == "track" || val == "trail" {
-				isTrail = true
-				trailType = val
-			}
+	for _, id := range relationIDs {
+		relation := osmData.Relations[id]
+		if !osm.IsNamedHikingRoute(relation) || !osm.Overlaps(relation.BBox, bbox) {
+			continue
 		}
 
-		// Get the name if available
-		if val, ok := way.Tags["name"]; ok {
-			name = val
-		}
+		wayIDs := relation.WayIDs()
+		trails = append(trails, osm.Trail{
+			ID:        id,
+			Name:      relation.Tags["name"],
+			Type:      relation.Tags["route"],
+			WayIDs:    wayIDs,
+			Relation:  true,
+			Polylines: osmData.ChainWays(wayIDs),
+		})
+	}
 
-		// Only include named trails
-		if isTrail && name != "" {
-			trail := osm.Trail{
-				ID:     id,
-				Name:   name,
-				Type:   trailType,
-				WayIDs: way.Nodes,
-			}
-			trails = append(trails, trail)
+	// Collect trail ways in the area, which are then stitched together with
+	// any connected ways of the same name
+	var seeds []int64
+	for _, way := range osmData.QueryBBox(bbox) {
+		if osmData.IncludeTrailWay(way) {
+			seeds = append(seeds, way.ID)
 		}
 	}
+	trails = append(trails, osmData.StitchWays(seeds, osmData.IncludeTrailWay)...)
 
 	return trails, nil
 }
 
-// matchTrailsWithPoints matches GPX track points against OSM trails
-func matchTrailsWithPoints(osmData *osm.OSMData, trackPoints []types.Point, trails []osm.Trail) ([]types.TrailMatch, error) {
-	var matches []types.TrailMatch
-
-	for _, trail := range trails {
-		// Get all points for this trail's way
-		var trailPoints []types.Point
+// trailSegments returns the points of each of a trail's polylines
+func trailSegments(osmData *osm.OSMData, trail osm.Trail) [][]types.Point {
+	var segments [][]types.Point
 
-		// For each node ID in the way, get its coordinates
-		for _, nodeID := range trail.WayIDs {
+	for _, polyline := range trail.Polylines {
+		// For each node ID in the polyline, get its coordinates
+		var points []types.Point
+		for _, nodeID := range polyline {
 			if node, exists := osmData.Nodes[nodeID]; exists {
-				trailPoints = append(trailPoints, types.Point{
+				points = append(points, types.Point{
 					Lat: node.Lat,
 					Lon: node.Lon,
 				})
-			} else {
-				// Skip nodes that aren't in our data
-				continue
 			}
 		}
 
-		if len(trailPoints) == 0 {
-			// Skip trails with no points
-			continue
-		}
-
-		// Calculate similarity between track and trail
-		similarity := calculateSimilarity(trackPoints, trailPoints)
-
-		// Only include trails with reasonable similarity
-		if similarity > 0.5 {
-			// Calculate trail length in miles
-			trailLength := calculateTrailLength(trailPoints)
-
-			matches = append(matches, types.TrailMatch{
-				Name:       trail.Name,
-				Type:       trail.Type,
-				Length:     trailLength,
-				Similarity: similarity,
-				OSMId:      trail.ID,
-			})
+		if len(points) > 0 {
+			segments = append(segments, points)
 		}
 	}
 
-	// Sort matches by similarity (highest first)
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].Similarity > matches[j].Similarity
-	})
+	return segments
+}
 
-	// Return top matches (up to 5)
-	maxResults := 5
-	if len(matches) < maxResults {
-		maxResults = len(matches)
-	}
+// matchTrailsWithPoints matches GPX track points against OSM trails, by measuring
+// how much of each trail's length the track covers. If opts.Explain is set, every
+// trail considered is also returned as a candidate along with why it was accepted or rejected.
+func matchTrailsWithPoints(osmData *osm.OSMData, trackPoints []types.Point, trails []osm.Trail, opts MatchOptions) ([]types.TrailMatch, []types.TrailCandidate, error) {
+	var matches []types.TrailMatch
+	var candidates []types.TrailCandidate
 
-	if maxResults == 0 {
-		return []types.TrailMatch{}, nil
+	reject := func(match types.TrailMatch, reason string) {
+		if opts.Explain {
+			candidates = append(candidates, types.TrailCandidate{Match: match, Reason: reason})
+		}
 	}
 
-	return matches[:maxResults], nil
-}
+	// Index the track once, it is checked against every nearby trail
+	idx := newTrackIndex(trackPoints, opts.MatchDistance)
 
-// calculateSimilarity measures the similarity between two sets of points
-func calculateSimilarity(track1, track2 []types.Point) float64 {
-	// Sample points for efficient processing
-	sampleSize := 20
-	track1Sample := samplePoints(track1, sampleSize)
-	track2Sample := samplePoints(track2, sampleSize)
+	for _, trail := range trails {
+		osmType := "way"
+		if trail.Relation {
+			osmType = "relation"
+		}
+		match := types.TrailMatch{
+			Name:    trail.Name,
+			Type:    trail.Type,
+			OSMId:   trail.ID,
+			OSMType: osmType,
+		}
 
-	// Calculate Frechet distance (simplified implementation)
-	totalDistance := 0.0
-	matchCount := 0
-
-	for _, p1 := range track1Sample {
-		minDist := math.MaxFloat64
-		for _, p2 := range track2Sample {
-			dist := haversineDistance(p1.Lat, p1.Lon, p2.Lat, p2.Lon)
-			if dist < minDist {
-				minDist = dist
-			}
+		// Get all points for this trail's polylines
+		segments := trailSegments(osmData, trail)
+		if len(segments) == 0 {
+			reject(match, "no trail nodes in the OSM data")
+			continue
 		}
-		totalDistance += minDist
-		matchCount++
-	}
 
-	avgDistance := totalDistance / float64(matchCount)
+		result := trailCoverage(idx, segments, opts.MatchDistance, opts.SampleSpacing)
+		if result.total == 0 {
+			reject(match, "trail has no length")
+			continue
+		}
+		coverage := result.covered / result.total
+
+		match.Length = calculateTrailLength(segments) // miles, across the whole joined trail
+		match.Similarity = coverage
+		match.Coverage = math.Round(coverage*1000) / 10
+		match.CoveredLength = math.Round(result.covered/metersPerMile*10) / 10
+		match.CoveredSegments = result.segments
+		match.PolylineLengths = result.polylineLengths
+
+		// Include trails which were mostly walked, or walked for a good distance
+		// even if only a small part of a long trail
+		if coverage*100 < opts.MinCoverage && result.covered < opts.MinCoveredLength {
+			reject(match, fmt.Sprintf("under %g%% covered and under %gm walked (%.0fm)", opts.MinCoverage, opts.MinCoveredLength, result.covered))
+			continue
+		}
 
-	// Convert to similarity score (closer to 1 is better)
-	// 100m is excellent match, 1000m is poor match
-	similarity := math.Max(0, 1.0-(avgDistance/1.0)) // 1.0 km threshold
+		match.Park = osmData.TrailPark(trail)
+		matches = append(matches, match)
+	}
 
-	return similarity
-}
+	// Sort matches by how much of them was walked (most first), then by OSM type
+	// and ID, so equally walked trails are always kept or dropped the same way
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].CoveredLength != matches[j].CoveredLength {
+			return matches[i].CoveredLength > matches[j].CoveredLength
+		}
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		if matches[i].OSMType != matches[j].OSMType {
+			return matches[i].OSMType < matches[j].OSMType
+		}
+		return matches[i].OSMId < matches[j].OSMId
+	})
 
-// samplePoints selects representative points from a track
-func samplePoints(track []types.Point, count int) []types.Point {
-	if len(track) <= count {
-		return track
+	// Return top matches
+	maxResults := len(matches)
+	if opts.MaxResults > 0 && opts.MaxResults < maxResults {
+		maxResults = opts.MaxResults
 	}
 
-	result := make([]types.Point, count)
-	step := float64(len(track)) / float64(count)
-
-	for i := 0; i < count; i++ {
-		idx := int(math.Floor(float64(i) * step))
-		if idx >= len(track) {
-			idx = len(track) - 1
+	if opts.Explain {
+		for i, match := range matches {
+			candidate := types.TrailCandidate{Match: match, Accepted: i < maxResults}
+			switch {
+			case !candidate.Accepted:
+				candidate.Reason = fmt.Sprintf("not among the best %d matches", opts.MaxResults)
+			case match.Similarity*100 >= opts.MinCoverage:
+				candidate.Reason = fmt.Sprintf("at least %g%% covered", opts.MinCoverage)
+			default:
+				candidate.Reason = fmt.Sprintf("at least %gm walked", opts.MinCoveredLength)
+			}
+			candidates = append(candidates, candidate)
 		}
-		result[i] = track[idx]
+		// Show accepted trails first, then the rest by how much of them was walked
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].Accepted != candidates[j].Accepted {
+				return candidates[i].Accepted
+			}
+			return candidates[i].Match.CoveredLength > candidates[j].Match.CoveredLength
+		})
 	}
 
-	return result
-}
-
-// haversineDistance calculates the distance between two coordinates in kilometers
-func haversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const earthRadius = 6371.0 // km
-
-	lat1Rad := lat1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	lon1Rad := lon1 * math.Pi / 180
-	lon2Rad := lon2 * math.Pi / 180
-
-	dLat := lat2Rad - lat1Rad
-	dLon := lon2Rad - lon1Rad
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	distance := earthRadius * c
+	if maxResults == 0 {
+		return []types.TrailMatch{}, candidates, nil
+	}
 
-	return distance
+	return matches[:maxResults], candidates, nil
 }
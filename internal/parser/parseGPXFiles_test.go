@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toozej/trails-completionist/pkg/osm"
+)
+
+// writeGPX writes a GPX file with a single track along the given points
+func writeGPX(t *testing.T, path string, lat1, lon1, lat2, lon2 float64) {
+	t.Helper()
+	var points strings.Builder
+	for _, point := range line(lat1, lon1, lat2, lon2, 20) {
+		fmt.Fprintf(&points, `<trkpt lat="%f" lon="%f"><time>2024-05-01T09:00:00Z</time></trkpt>`, point.Lat, point.Lon)
+	}
+	content := `<?xml version="1.0"?><gpx version="1.1" creator="test"><trk><trkseg>` + points.String() + `</trkseg></trk></gpx>`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testOSMData returns OSM data for a single named trail running 0.01 degrees north
+func testOSMData() *osm.OSMData {
+	osmData := &osm.OSMData{
+		Nodes: map[int64]osm.OSMNode{
+			1: {ID: 1, Lat: 45.50, Lon: -122.70},
+			2: {ID: 2, Lat: 45.51, Lon: -122.70},
+		},
+		Ways: map[int64]osm.OSMWay{
+			10: {ID: 10, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "path", "name": "Walked Trail"}},
+		},
+	}
+	for id, way := range osmData.Ways {
+		way.BBox = osm.CalculateWayBBox(way, osmData.Nodes)
+		osmData.Ways[id] = way
+	}
+	osmData.BuildWayIndex()
+	return osmData
+}
+
+func TestProcessDirectory_Order(t *testing.T) {
+	dir := t.TempDir()
+	var expected []string
+	for i := range 12 {
+		path := filepath.Join(dir, fmt.Sprintf("hike-%02d.gpx", i))
+		writeGPX(t, path, 45.50, -122.70, 45.51, -122.70)
+		expected = append(expected, path)
+	}
+	// Unreadable files are skipped without affecting the order of the rest
+	if err := os.WriteFile(filepath.Join(dir, "hike-05a.gpx"), []byte("not gpx"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testMatchOptions()
+	opts.Workers = 4
+	results, err := processDirectory(context.Background(), dir, false, testOSMData(), opts, nil)
+	if err != nil {
+		t.Fatalf("processDirectory returned error: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.Filename != expected[i] {
+			t.Errorf("result %d: got %s, expected %s", i, result.Filename, expected[i])
+		}
+		if len(result.Matches) != 1 || result.Matches[0].Name != "Walked Trail" {
+			t.Errorf("result %d: unexpected matches %+v", i, result.Matches)
+		}
+	}
+}
+
+func TestProcessDirectory_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	writeGPX(t, filepath.Join(dir, "hike.gpx"), 45.50, -122.70, 45.51, -122.70)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := processDirectory(ctx, dir, false, testOSMData(), testMatchOptions(), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+}
+
+func TestMatchTrailsWithPoints_TiesInIDOrder(t *testing.T) {
+	// Overlapping routes along the same way are walked equally
+	osmData := testOSMData()
+	osmData.Relations = make(map[int64]osm.OSMRelation)
+	for _, id := range []int64{105, 101, 104, 102, 103} {
+		relation := osm.OSMRelation{
+			ID:      id,
+			Members: []osm.OSMMember{{Type: "way", Ref: 10}},
+			Tags:    map[string]string{"type": "route", "route": "hiking", "name": fmt.Sprintf("Route %d", id)},
+		}
+		relation.BBox = osm.CalculateRelationBBox(relation, osmData.Ways)
+		osmData.Relations[id] = relation
+	}
+	track := line(45.50, -122.70, 45.51, -122.70, 50)
+	opts := testMatchOptions()
+	opts.MaxResults = 2
+
+	for range 10 {
+		trails, err := queryTrailsFromOSM(osmData, calculateBoundingBox(track, opts.BBoxBuffer))
+		if err != nil {
+			t.Fatalf("queryTrailsFromOSM returned error: %v", err)
+		}
+		matches, _, err := matchTrailsWithPoints(osmData, track, trails, opts)
+		if err != nil {
+			t.Fatalf("matchTrailsWithPoints returned error: %v", err)
+		}
+		if len(matches) != 2 || matches[0].OSMId != 101 || matches[1].OSMId != 102 {
+			t.Fatalf("expected the lowest relation IDs to be kept, got %+v", matches)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -32,12 +34,32 @@ func extractTrailInfo(file *os.File) ([]types.Trail, error) {
 	var trails []types.Trail
 	var currentTrail types.Trail
 
+	// index of the trail the last batch of lines described, which an optional URL line belongs to
+	lastTrail := -1
+
 	// Read file in batches of 3 lines and parse trail information
 	scanner := bufio.NewScanner(file)
 	var lines []string
+	var lineNumber int
 	for scanner.Scan() {
 		line := scanner.Text()
 		line = strings.TrimSpace(line)
+		lineNumber++
+
+		// An optional 4th line of a trail is its URL
+		if isURLLine(line) {
+			if len(lines) > 0 || lastTrail < 0 {
+				fmt.Printf("Warning: %s:%d: URL line must follow a trail's park line, ignoring it\n", file.Name(), lineNumber)
+				continue
+			}
+			if trailURL := parseTrailURL(line); trailURL == "" {
+				fmt.Printf("Warning: %s:%d: invalid trail URL %q\n", file.Name(), lineNumber, line)
+			} else if trails[lastTrail].URL == "" {
+				trails[lastTrail].URL = trailURL
+			}
+			continue
+		}
+
 		// Check if the line is not empty
 		if line != "" {
 			lines = append(lines, line)
@@ -46,24 +68,23 @@ func extractTrailInfo(file *os.File) ([]types.Trail, error) {
 			if len(lines) == 3 {
 				// Parse the trail information
 				currentTrail = types.Trail{
-					Name:           parseTrailName(lines[0]),
-					Park:           parseTrailPark(lines[2]),
-					Type:           parseTrailType(lines[1]),
-					Length:         parseTrailLength(lines[1]),
-					URL:            parseTrailURL(""),
-					Completed:      false,
-					CompletionDate: "",
+					Name:      parseTrailName(lines[0]),
+					Park:      parseTrailPark(lines[2]),
+					Type:      parseTrailType(lines[1]),
+					Length:    parseTrailLength(lines[1]),
+					Completed: false,
 				}
 				// Check if the current trail is already in the list
-				exists := false
-				for _, trail := range trails {
+				lastTrail = -1
+				for i, trail := range trails {
 					if trail.Name == currentTrail.Name && trail.Park == currentTrail.Park {
-						exists = true
+						lastTrail = i
 						break
 					}
 				}
-				if !exists {
+				if lastTrail < 0 {
 					trails = append(trails, currentTrail)
+					lastTrail = len(trails) - 1
 				}
 
 				// Reset the lines slice for the next batch
@@ -79,15 +100,15 @@ func parseTrailName(input string) string {
 	return strings.TrimSpace(input)
 }
 
-func parseTrailType(input string) string {
-	// Regular expression to parse trail type and length
-	re := regexp.MustCompile(`^(\S+)\s+(\d+(\.\d+)?)\s+miles$`)
+// rawTypeLengthRegex parses the trail type and length, such as "Trail 0.5 miles" or "Connector 300 ft"
+var rawTypeLengthRegex = regexp.MustCompile(`^(\S+)\s+(\d+(?:\.\d+)?\s*[a-zA-Z]*)$`)
 
+func parseTrailType(input string) string {
 	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
+	match := rawTypeLengthRegex.FindStringSubmatch(input)
 
 	var trailType string
-	if len(match) == 4 {
+	if len(match) == 3 {
 		trailType = match[1]
 	} else {
 		trailType = ""
@@ -96,18 +117,18 @@ func parseTrailType(input string) string {
 	return trailType
 }
 
-func parseTrailLength(input string) string {
-	// Regular expression to parse trail type and length
-	re := regexp.MustCompile(`^(\S+)\s+(\d+(\.\d+)?)\s+miles$`)
-
+func parseTrailLength(input string) types.Distance {
 	// FindStringSubmatch returns a slice of strings containing the text of the leftmost match
-	match := re.FindStringSubmatch(input)
+	match := rawTypeLengthRegex.FindStringSubmatch(input)
+	if len(match) != 3 {
+		fmt.Printf("Warning: no trail length found in %q\n", input)
+		return 0
+	}
 
-	var trailLength string
-	if len(match) == 4 {
-		trailLength = match[2]
-	} else {
-		trailLength = "0.0 miles"
+	trailLength, err := types.ParseDistance(match[2])
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return 0
 	}
 
 	return trailLength
@@ -130,9 +151,19 @@ func parseTrailPark(input string) string {
 	return trailPark
 }
 
-// TODO: implement parseTrailURL function once I have a better input dataset which includes URL links to trails
+// isURLLine checks if a raw input line is a URL rather than part of a trail's 3 lines
+func isURLLine(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// parseTrailURL returns the trail URL on a raw input line, or "" if it isn't a valid web address
 func parseTrailURL(input string) string {
-	return input
+	u, err := url.Parse(input)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+
+	return u.String()
 }
 
 func ParseTrailsFromRawInputFile(filename string) ([]types.Trail, error) {
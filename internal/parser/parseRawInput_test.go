@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+func TestParseTrailLength(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantType string
+		want     types.Distance
+	}{
+		{"Trail 0.5 miles", "Trail", types.Miles(0.5)},
+		{"Connector 0.2 mi", "Connector", types.Miles(0.2)},
+		{"Trail 2.4 km", "Trail", 2.4 * types.Kilometer},
+		{"Connector 300 ft", "Connector", 300 * types.Foot},
+		{"Connector 300 m", "Connector", 300 * types.Meter},
+		{"Trail", "", 0},
+	}
+	for _, test := range tests {
+		if got := parseTrailType(test.input); got != test.wantType {
+			t.Errorf("parseTrailType(%q) = %q, want %q", test.input, got, test.wantType)
+		}
+		if got := parseTrailLength(test.input); got != test.want {
+			t.Errorf("parseTrailLength(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseLegacyTrailLengthFromChecklist(t *testing.T) {
+	tests := []struct {
+		input string
+		want  types.Distance
+	}{
+		{"7.3 miles", types.Miles(7.3)},
+		{"11.7 km", 11.7 * types.Kilometer},
+		{"500 ft", 500 * types.Foot},
+	}
+	for _, test := range tests {
+		var trail types.Trail
+		if err := parseLegacyTrailFieldFromChecklist(&trail, test.input); err != nil {
+			t.Errorf("parseLegacyTrailFieldFromChecklist(%q) returned error: %v", test.input, err)
+		}
+		if trail.Length != test.want {
+			t.Errorf("parseLegacyTrailFieldFromChecklist(%q) length = %v, want %v", test.input, trail.Length, test.want)
+		}
+	}
+}
+
+func TestParseTrailsFromRawInputFile_URLs(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "trails.txt")
+	content := `Cooks Butte Park
+Trail 0.5 miles
+Oregon > Portland Metro and Mt. Hood > Portland
+https://example.com/cooks-butte
+
+Pioneer Park Loop B
+Connector 0.2 miles
+Oregon > Portland Metro and Mt. Hood > Portland
+
+Dog Park Loop
+https://example.com/misplaced
+Connector 0.3 miles
+Oregon > Portland Metro and Mt. Hood > Portland
+`
+	if err := os.WriteFile(input, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	trails, err := ParseTrailsFromRawInputFile(input)
+	if err != nil {
+		t.Fatalf("ParseTrailsFromRawInputFile returned error: %v", err)
+	}
+	if len(trails) != 3 {
+		t.Fatalf("expected 3 trails, got %d: %v", len(trails), trails)
+	}
+	if trails[0].URL != "https://example.com/cooks-butte" {
+		t.Errorf("expected Cooks Butte Park's URL, got %q", trails[0].URL)
+	}
+	if trails[1].URL != "" || trails[2].URL != "" {
+		t.Errorf("expected no other URLs, got %q and %q", trails[1].URL, trails[2].URL)
+	}
+	if trails[2].Name != "Dog Park Loop" || trails[2].Length != types.Miles(0.3) {
+		t.Errorf("expected a misplaced URL line to be skipped, got %v", trails[2])
+	}
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/toozej/trails-completionist/internal/types"
+	"github.com/toozej/trails-completionist/pkg/osm"
+)
+
+// resultsCacheVersion is the version of the cached TrailResult layout. It must be
+// bumped whenever types.TrailResult or the matching algorithm changes, so results
+// cached by older versions are reprocessed.
+const resultsCacheVersion = 4
+
+// resultsCache stores the result of processing each GPX file, so later runs only
+// process new or changed files. Entries are keyed by the GPX file's SHA-256, in a
+// directory keyed by everything else the result depends on: the cache version, the
+// OSM data and the match options.
+type resultsCache struct {
+	dir string
+}
+
+// DefaultResultsCacheDir returns the directory results are cached in when none is configured
+func DefaultResultsCacheDir() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache directory: %w", err)
+	}
+	return filepath.Join(userCacheDir, "trails-completionist", "results"), nil
+}
+
+// resultsCacheKeyBytes is the length of the key naming each cache directory, before hex encoding
+const resultsCacheKeyBytes = 8
+
+// openResultsCache opens the results cache for the given OSM data checksum and match
+// options under baseDir. If rebuild is set, all previously cached results are removed.
+func openResultsCache(baseDir, osmChecksum string, opts MatchOptions, rebuild bool) (*resultsCache, error) {
+	if rebuild {
+		if err := removeCachedResults(baseDir); err != nil {
+			return nil, fmt.Errorf("error removing results cache: %w", err)
+		}
+	}
+
+	// Workers and Explain don't change the matches, so aren't part of the key
+	key := sha256.Sum256(fmt.Appendf(nil, "%d|%d|%s|%g|%g|%g|%g|%g|%d",
+		resultsCacheVersion, osm.CacheFormatVersion, osmChecksum,
+		opts.BBoxBuffer, opts.MatchDistance, opts.SampleSpacing, opts.MinCoverage, opts.MinCoveredLength, opts.MaxResults))
+	dir := filepath.Join(baseDir, hex.EncodeToString(key[:resultsCacheKeyBytes]))
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating results cache directory: %w", err)
+	}
+	return &resultsCache{dir: dir}, nil
+}
+
+// removeCachedResults removes the cache entries, and any temporary files left writing them,
+// from every cache directory under baseDir. Since baseDir may be any directory the user
+// configured, nothing else in it is touched, and cache directories are only removed once empty.
+func removeCachedResults(baseDir string) error {
+	entries, err := os.ReadDir(baseDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !isResultsCacheKey(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(baseDir, entry.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.Type().IsRegular() && (filepath.Ext(name) == ".gob" || filepath.Ext(name) == ".tmp") {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					return err
+				}
+			}
+		}
+		// Left in place if anything else is in it
+		_ = os.Remove(dir)
+	}
+	return nil
+}
+
+// isResultsCacheKey checks if a directory name is a key openResultsCache names cache directories with
+func isResultsCacheKey(name string) bool {
+	key, err := hex.DecodeString(name)
+	return err == nil && len(key) == resultsCacheKeyBytes
+}
+
+// hashGPXFile returns the hex-encoded SHA-256 hash of a GPX file
+func hashGPXFile(filePath string) (string, error) {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// entryPath returns the path of the cache entry for a GPX file hash
+func (c *resultsCache) entryPath(fileHash string) string {
+	return filepath.Join(c.dir, fileHash+".gob")
+}
+
+// load returns the cached result for a GPX file hash, if there is one
+func (c *resultsCache) load(fileHash string) (types.TrailResult, bool) {
+	var result types.TrailResult
+
+	file, err := os.Open(c.entryPath(fileHash)) // #nosec G304
+	if err != nil {
+		return result, false
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(&result); err != nil {
+		return types.TrailResult{}, false
+	}
+	return result, true
+}
+
+// save caches the result for a GPX file hash, writing to a temporary file first
+// so concurrent readers never see a partial entry
+func (c *resultsCache) save(fileHash string, result types.TrailResult) error {
+	// Candidates are only recorded when explaining, and aren't needed again
+	result.Candidates = nil
+
+	file, err := os.CreateTemp(c.dir, fileHash+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating results cache entry: %w", err)
+	}
+	tmpPath := file.Name()
+
+	err = gob.NewEncoder(file).Encode(result)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error writing results cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.entryPath(fileHash)); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error replacing results cache entry: %w", err)
+	}
+	return nil
+}
+
+// processGPXFileCached processes a GPX file, reusing its cached result if the file is
+// unchanged. It reports whether the result came from the cache. A nil cache disables caching.
+func processGPXFileCached(cache *resultsCache, filePath string, osmData *osm.OSMData, opts MatchOptions) (types.TrailResult, bool, error) {
+	if cache == nil {
+		result, err := processGPXFile(filePath, osmData, opts)
+		return result, false, err
+	}
+
+	fileHash, err := hashGPXFile(filePath)
+	if err != nil {
+		return types.TrailResult{Filename: filePath}, false, fmt.Errorf("error hashing GPX file: %w", err)
+	}
+
+	// Candidates aren't cached, so explaining always reprocesses files
+	if !opts.Explain {
+		if result, ok := cache.load(fileHash); ok {
+			result.Filename = filePath
+			return result, true, nil
+		}
+	}
+
+	result, err := processGPXFile(filePath, osmData, opts)
+	if err != nil {
+		return result, false, err
+	}
+	if err := cache.save(fileHash, result); err != nil {
+		fmt.Printf("  Warning: Could not cache results for %s: %v\n", filePath, err)
+	}
+	return result, false, nil
+}
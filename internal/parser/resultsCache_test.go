@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResultsCache(t *testing.T) {
+	trackDir, cacheDir := t.TempDir(), t.TempDir()
+	first := filepath.Join(trackDir, "first.gpx")
+	second := filepath.Join(trackDir, "second.gpx")
+	writeGPX(t, first, 45.50, -122.70, 45.51, -122.70)
+	writeGPX(t, second, 45.50, -122.70, 45.505, -122.70)
+
+	osmData := testOSMData()
+	opts := testMatchOptions()
+
+	cache, err := openResultsCache(cacheDir, "osm-checksum", opts, false)
+	if err != nil {
+		t.Fatalf("openResultsCache returned error: %v", err)
+	}
+	processed, err := processDirectory(context.Background(), trackDir, false, osmData, opts, cache)
+	if err != nil {
+		t.Fatalf("processDirectory returned error: %v", err)
+	}
+
+	// Unchanged files are loaded from the cache, even when moved
+	moved := filepath.Join(trackDir, "moved.gpx")
+	if err := os.Rename(first, moved); err != nil {
+		t.Fatal(err)
+	}
+	result, cached, err := processGPXFileCached(cache, moved, osmData, opts)
+	if err != nil || !cached {
+		t.Fatalf("expected cached result, got cached=%v err=%v", cached, err)
+	}
+	expected := processed[0]
+	expected.Filename = moved
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("cached result differs:\ngot      %+v\nexpected %+v", result, expected)
+	}
+
+	// Changed files are processed again
+	writeGPX(t, second, 45.505, -122.70, 45.51, -122.70)
+	if _, cached, _ := processGPXFileCached(cache, second, osmData, opts); cached {
+		t.Error("expected changed file to be processed again")
+	}
+
+	// Different OSM data or match options use separate entries
+	other, err := openResultsCache(cacheDir, "other-checksum", opts, false)
+	if err != nil {
+		t.Fatalf("openResultsCache returned error: %v", err)
+	}
+	if _, cached, _ := processGPXFileCached(other, moved, osmData, opts); cached {
+		t.Error("expected results cached for other OSM data to be ignored")
+	}
+
+	// Rebuilding discards every cached result
+	rebuilt, err := openResultsCache(cacheDir, "osm-checksum", opts, true)
+	if err != nil {
+		t.Fatalf("openResultsCache returned error: %v", err)
+	}
+	if _, cached, _ := processGPXFileCached(rebuilt, moved, osmData, opts); cached {
+		t.Error("expected rebuilt cache to be empty")
+	}
+}
+
+func TestResultsCache_RebuildKeepsOtherFiles(t *testing.T) {
+	trackDir, cacheDir := t.TempDir(), t.TempDir()
+	track := filepath.Join(trackDir, "track.gpx")
+	writeGPX(t, track, 45.50, -122.70, 45.51, -122.70)
+	osmData := testOSMData()
+	opts := testMatchOptions()
+
+	cache, err := openResultsCache(cacheDir, "osm-checksum", opts, false)
+	if err != nil {
+		t.Fatalf("openResultsCache returned error: %v", err)
+	}
+	if _, _, err := processGPXFileCached(cache, track, osmData, opts); err != nil {
+		t.Fatalf("processGPXFileCached returned error: %v", err)
+	}
+
+	// The cache directory may be shared with unrelated files
+	unrelated := []string{
+		filepath.Join(cacheDir, "notes.txt"),
+		filepath.Join(cacheDir, "photos", "trailhead.jpg"),
+		filepath.Join(cache.dir, "README"),
+	}
+	for _, path := range unrelated {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("keep me"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rebuilt, err := openResultsCache(cacheDir, "osm-checksum", opts, true)
+	if err != nil {
+		t.Fatalf("openResultsCache returned error: %v", err)
+	}
+	if _, cached, _ := processGPXFileCached(rebuilt, track, osmData, opts); cached {
+		t.Error("expected rebuilt cache to be empty")
+	}
+	for _, path := range unrelated {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to survive rebuilding the cache: %v", path, err)
+		}
+	}
+}
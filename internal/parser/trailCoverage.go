@@ -0,0 +1,274 @@
+package parser
+
+import (
+	"math"
+	"sort"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+const (
+	// earthRadiusMeters is the mean Earth radius used for the local projection
+	earthRadiusMeters = 6371000.0
+
+	// metersPerMile converts covered lengths into miles for reporting
+	metersPerMile = 1609.344
+)
+
+// xy is a point projected into meters on a local plane
+type xy struct {
+	X float64
+	Y float64
+}
+
+// projection is an equirectangular projection centred on a GPX track, which is
+// accurate to well under a meter over the few kilometers a hike covers
+type projection struct {
+	cosLat float64
+}
+
+// newProjection creates a projection centred on the given points
+func newProjection(points []types.Point) projection {
+	sumLat := 0.0
+	for _, point := range points {
+		sumLat += point.Lat
+	}
+	meanLat := sumLat / float64(len(points))
+	return projection{cosLat: math.Cos(meanLat * math.Pi / 180)}
+}
+
+// project converts a point to meters on the local plane
+func (p projection) project(point types.Point) xy {
+	return xy{
+		X: earthRadiusMeters * point.Lon * math.Pi / 180 * p.cosLat,
+		Y: earthRadiusMeters * point.Lat * math.Pi / 180,
+	}
+}
+
+// trackIndex is a grid over the segments of a GPX track, used to quickly find
+// the distance from any point to the track
+type trackIndex struct {
+	projection projection
+	cellSize   float64
+	segments   [][2]xy
+	cells      map[[2]int][]int
+}
+
+// newTrackIndex builds a track index, with grid cells no smaller than the match distance
+// so only neighbouring cells ever need to be checked
+func newTrackIndex(trackPoints []types.Point, maxDistance float64) *trackIndex {
+	idx := &trackIndex{
+		projection: newProjection(trackPoints),
+		cellSize:   math.Max(maxDistance, 25),
+		cells:      make(map[[2]int][]int),
+	}
+
+	projected := make([]xy, len(trackPoints))
+	for i, point := range trackPoints {
+		projected[i] = idx.projection.project(point)
+	}
+
+	// A single point track is treated as a zero-length segment
+	if len(projected) == 1 {
+		projected = append(projected, projected[0])
+	}
+
+	for i := 1; i < len(projected); i++ {
+		idx.segments = append(idx.segments, [2]xy{projected[i-1], projected[i]})
+		idx.addSegment(len(idx.segments) - 1)
+	}
+
+	return idx
+}
+
+// addSegment adds a segment to the grid cells its line passes through. Walking the grid
+// cell by cell along the line (Amanatides and Woo's traversal), rather than filling the
+// segment's bounding box, keeps a long diagonal gap in a track from filling millions of cells.
+func (idx *trackIndex) addSegment(i int) {
+	a, b := idx.segments[i][0], idx.segments[i][1]
+	col, row := idx.cell(a)
+	endCol, endRow := idx.cell(b)
+
+	// nextX and nextY are how far along the segment, as a fraction of its length, the
+	// next column and row boundaries are, and stepX and stepY the fraction between boundaries
+	stepCol, nextX, stepX := traversalStep(a.X, b.X, col, idx.cellSize)
+	stepRow, nextY, stepY := traversalStep(a.Y, b.Y, row, idx.cellSize)
+
+	idx.cells[[2]int{col, row}] = append(idx.cells[[2]int{col, row}], i)
+	for col != endCol || row != endRow {
+		// Once one axis reaches the end cell only the other moves, so rounding can't overshoot
+		if row == endRow || (col != endCol && nextX < nextY) {
+			col += stepCol
+			nextX += stepX
+		} else {
+			row += stepRow
+			nextY += stepY
+		}
+		idx.cells[[2]int{col, row}] = append(idx.cells[[2]int{col, row}], i)
+	}
+}
+
+// traversalStep returns the direction a segment from start to end crosses grid lines along
+// one axis, the fraction of the segment before it crosses the first one after the cell it
+// starts in, and the fraction between crossings
+func traversalStep(start, end float64, cell int, cellSize float64) (int, float64, float64) {
+	delta := end - start
+	switch {
+	case delta > 0:
+		return 1, (float64(cell+1)*cellSize - start) / delta, cellSize / delta
+	case delta < 0:
+		return -1, (float64(cell)*cellSize - start) / delta, -cellSize / delta
+	}
+	return 0, math.Inf(1), math.Inf(1)
+}
+
+// cell returns the grid column and row containing a projected point
+func (idx *trackIndex) cell(p xy) (int, int) {
+	return int(math.Floor(p.X / idx.cellSize)), int(math.Floor(p.Y / idx.cellSize))
+}
+
+// distance returns the distance in meters from a projected point to the nearest
+// track segment, or +Inf if the track is further away than one grid cell
+func (idx *trackIndex) distance(p xy) float64 {
+	minDist := math.Inf(1)
+	col, row := idx.cell(p)
+	for dc := -1; dc <= 1; dc++ {
+		for dr := -1; dr <= 1; dr++ {
+			for _, i := range idx.cells[[2]int{col + dc, row + dr}] {
+				minDist = math.Min(minDist, pointToSegmentDistance(p, idx.segments[i][0], idx.segments[i][1]))
+			}
+		}
+	}
+	return minDist
+}
+
+// pointToSegmentDistance returns the distance from p to the segment a-b
+func pointToSegmentDistance(p, a, b xy) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+
+	// Project p onto the segment, clamped to its ends
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / lengthSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// coverageResult is the coverage of a trail by a single GPX track
+type coverageResult struct {
+	covered         float64              // meters
+	total           float64              // meters
+	segments        []types.TrailSegment // covered stretches of the trail
+	polylineLengths []float64            // miles
+}
+
+// trailCoverage measures how much of a trail lies within maxDistance meters of the
+// GPX track. Each trail edge is split into pieces no longer than sampleSpacing meters,
+// and a piece counts as covered when its midpoint is close enough to any track segment.
+// Consecutive covered pieces are joined into the covered stretches of each polyline.
+func trailCoverage(idx *trackIndex, polylines [][]types.Point, maxDistance, sampleSpacing float64) coverageResult {
+	var result coverageResult
+
+	for polylineIndex, polyline := range polylines {
+		along := 0.0 // meters from the start of the polyline
+		inSegment := false
+		var current types.TrailSegment
+
+		for i := 1; i < len(polyline); i++ {
+			a := idx.projection.project(polyline[i-1])
+			b := idx.projection.project(polyline[i])
+			length := math.Hypot(b.X-a.X, b.Y-a.Y)
+			if length == 0 {
+				continue
+			}
+			result.total += length
+
+			pieces := int(math.Ceil(length / sampleSpacing))
+			pieceLength := length / float64(pieces)
+			for j := 0; j < pieces; j++ {
+				t := (float64(j) + 0.5) / float64(pieces)
+				mid := xy{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+				start := along + float64(j)*pieceLength
+
+				if idx.distance(mid) <= maxDistance {
+					result.covered += pieceLength
+					if !inSegment {
+						current = types.TrailSegment{Polyline: polylineIndex, Start: start / metersPerMile}
+						inSegment = true
+					}
+					current.End = (start + pieceLength) / metersPerMile
+				} else if inSegment {
+					result.segments = append(result.segments, current)
+					inSegment = false
+				}
+			}
+			along += length
+		}
+
+		if inSegment {
+			result.segments = append(result.segments, current)
+		}
+		result.polylineLengths = append(result.polylineLengths, along/metersPerMile)
+	}
+
+	return result
+}
+
+// mergeSegments returns the union of covered stretches, sorted by polyline and start
+func mergeSegments(segments []types.TrailSegment) []types.TrailSegment {
+	sorted := append([]types.TrailSegment{}, segments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Polyline != sorted[j].Polyline {
+			return sorted[i].Polyline < sorted[j].Polyline
+		}
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var merged []types.TrailSegment
+	for _, segment := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].Polyline == segment.Polyline && segment.Start <= merged[last].End {
+			merged[last].End = math.Max(merged[last].End, segment.End)
+			continue
+		}
+		merged = append(merged, segment)
+	}
+	return merged
+}
+
+// uncoveredSegments returns the stretches of each polyline not covered by the
+// merged covered stretches, ignoring gaps shorter than minGap miles
+func uncoveredSegments(merged []types.TrailSegment, polylineLengths []float64, minGap float64) []types.TrailSegment {
+	var uncovered []types.TrailSegment
+
+	addGap := func(polyline int, start, end float64) {
+		if end-start >= minGap {
+			uncovered = append(uncovered, types.TrailSegment{Polyline: polyline, Start: start, End: end})
+		}
+	}
+
+	for polyline, length := range polylineLengths {
+		position := 0.0
+		for _, segment := range merged {
+			if segment.Polyline != polyline {
+				continue
+			}
+			addGap(polyline, position, segment.Start)
+			position = math.Max(position, segment.End)
+		}
+		addGap(polyline, position, length)
+	}
+
+	return uncovered
+}
+
+// coveredLength returns the total length in miles of merged covered stretches
+func coveredLength(merged []types.TrailSegment) float64 {
+	total := 0.0
+	for _, segment := range merged {
+		total += segment.End - segment.Start
+	}
+	return total
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// line returns evenly spaced points between two coordinates
+func line(lat1, lon1, lat2, lon2 float64, count int) []types.Point {
+	points := make([]types.Point, count)
+	for i := range points {
+		t := float64(i) / float64(count-1)
+		points[i] = types.Point{Lat: lat1 + t*(lat2-lat1), Lon: lon1 + t*(lon2-lon1)}
+	}
+	return points
+}
+
+func TestTrailCoverage(t *testing.T) {
+	// A trail running 0.01 degrees (about 1.1km) north
+	trail := [][]types.Point{line(45.50, -122.70, 45.51, -122.70, 2)}
+
+	tests := []struct {
+		name     string
+		track    []types.Point
+		expected float64
+	}{
+		{"whole trail, offset by 10m", line(45.50, -122.69987, 45.51, -122.69987, 50), 1.0},
+		{"southern half", line(45.50, -122.70, 45.505, -122.70, 20), 0.5 + 25.0/1112},
+		{"crossing the middle", line(45.505, -122.71, 45.505, -122.69, 20), 50.0 / 1112},
+		{"parallel, 100m away", line(45.50, -122.6987, 45.51, -122.6987, 50), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newTrackIndex(tt.track, 25)
+			result := trailCoverage(idx, trail, 25, 5)
+
+			if math.Abs(result.total-1112) > 5 {
+				t.Errorf("unexpected trail length: %.1fm", result.total)
+			}
+			if coverage := result.covered / result.total; math.Abs(coverage-tt.expected) > 0.02 {
+				t.Errorf("unexpected coverage: got %.3f, expected %.3f", coverage, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrackIndex_LongSegment(t *testing.T) {
+	// A 45km diagonal gap in a track, such as a GPS dropout on a drive home
+	track := []types.Point{{Lat: 45.30, Lon: -123.00}, {Lat: 45.60, Lon: -122.60}}
+	idx := newTrackIndex(track, 25)
+
+	// The line crosses at most one cell per 25m along each axis
+	if len(idx.cells) > 4000 {
+		t.Errorf("expected the segment to be added to the cells along its line, got %d cells", len(idx.cells))
+	}
+
+	// Every point near the segment still finds it
+	a, b := idx.segments[0][0], idx.segments[0][1]
+	for i := 0; i <= 1000; i++ {
+		f := float64(i) / 1000
+		p := xy{X: a.X + f*(b.X-a.X) + 17, Y: a.Y + f*(b.Y-a.Y) - 9}
+		if got, want := idx.distance(p), pointToSegmentDistance(p, a, b); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("point %d: indexed distance %.2f, expected %.2f", i, got, want)
+		}
+	}
+}
+
+func TestPointToSegmentDistance(t *testing.T) {
+	a, b := xy{0, 0}, xy{10, 0}
+
+	tests := []struct {
+		point    xy
+		expected float64
+	}{
+		{xy{5, 3}, 3},
+		{xy{-4, 3}, 5},
+		{xy{13, -4}, 5},
+	}
+
+	for _, tt := range tests {
+		if got := pointToSegmentDistance(tt.point, a, b); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("distance from %v: got %f, expected %f", tt.point, got, tt.expected)
+		}
+	}
+}
+
+func TestCombinedCoverage(t *testing.T) {
+	// Two hikes each covering part of the same trail, overlapping in the middle
+	first := []types.TrailSegment{{Polyline: 0, Start: 0, End: 0.4}}
+	second := []types.TrailSegment{{Polyline: 0, Start: 0.3, End: 0.6}, {Polyline: 1, Start: 0, End: 0.2}}
+	polylineLengths := []float64{1.0, 0.5}
+
+	merged := mergeSegments(append(first, second...))
+	if len(merged) != 2 || merged[0].End != 0.6 {
+		t.Fatalf("unexpected merged segments: %v", merged)
+	}
+	if got := coveredLength(merged); math.Abs(got-0.8) > 1e-9 {
+		t.Errorf("unexpected covered length: %f", got)
+	}
+
+	uncovered := uncoveredSegments(merged, polylineLengths, minUncoveredMiles)
+	expected := []types.TrailSegment{{Polyline: 0, Start: 0.6, End: 1.0}, {Polyline: 1, Start: 0.2, End: 0.5}}
+	if len(uncovered) != len(expected) {
+		t.Fatalf("unexpected uncovered segments: %v", uncovered)
+	}
+	for i := range expected {
+		if uncovered[i] != expected[i] {
+			t.Errorf("uncovered segment %d: got %v, expected %v", i, uncovered[i], expected[i])
+		}
+	}
+}
+
+func TestConvertTrailResultsToTrails_CompletionThreshold(t *testing.T) {
+	match := func(start, end float64) types.TrailMatch {
+		return types.TrailMatch{
+			Name:            "Wildwood Trail",
+			Type:            "hiking",
+			Length:          1.0,
+			OSMId:           100,
+			OSMType:         "relation",
+			CoveredSegments: []types.TrailSegment{{Start: start, End: end}},
+			PolylineLengths: []float64{1.0},
+		}
+	}
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 9, 0, 0, 0, time.UTC) }
+
+	// Given out of date order, the second hike completes the trail
+	results := []types.TrailResult{
+		{Filename: "c.gpx", TravelDate: day(3), Matches: []types.TrailMatch{match(0.9, 1.0)}},
+		{Filename: "a.gpx", TravelDate: day(1), Matches: []types.TrailMatch{match(0, 0.6)}},
+		{Filename: "b.gpx", TravelDate: day(2), Matches: []types.TrailMatch{match(0.5, 0.9)}},
+	}
+
+	trails, err := convertTrailResultsToTrails(results[1:2], 90)
+	if err != nil {
+		t.Fatalf("convertTrailResultsToTrails returned error: %v", err)
+	}
+	if len(trails) != 1 || trails[0].Completed || trails[0].PercentComplete != 60 {
+		t.Fatalf("expected one 60%% complete trail, got %+v", trails)
+	}
+
+	trails, err = convertTrailResultsToTrails(results, 90)
+	if err != nil {
+		t.Fatalf("convertTrailResultsToTrails returned error: %v", err)
+	}
+	if len(trails) != 1 {
+		t.Fatalf("expected coverage to be combined into one trail, got %+v", trails)
+	}
+	if !trails[0].Completed || !trails[0].CompletionDate.Equal(types.Day(day(2))) {
+		t.Errorf("expected trail completed on 05/02/2024, got %+v", trails[0])
+	}
+	if trails[0].PercentComplete != 100 || len(trails[0].UncoveredSegments) != 0 {
+		t.Errorf("expected trail fully covered, got %+v", trails[0])
+	}
+	// Neither partial pass on its own counts as a completion
+	if trails[0].HikeCount() != 1 || trails[0].Completions[0].SourceFile != "b.gpx" || !trails[0].LastHiked().Equal(types.Day(day(2))) {
+		t.Errorf("expected only the completing hike, got %+v", trails[0].Completions)
+	}
+
+	// A later hike covering the whole trail is another completion
+	results = append(results, types.TrailResult{Filename: "d.gpx", TravelDate: day(4), Matches: []types.TrailMatch{match(0, 0.95)}})
+	trails, err = convertTrailResultsToTrails(results, 90)
+	if err != nil {
+		t.Fatalf("convertTrailResultsToTrails returned error: %v", err)
+	}
+	if trails[0].HikeCount() != 2 || trails[0].Completions[1].SourceFile != "d.gpx" || !trails[0].LastHiked().Equal(types.Day(day(4))) {
+		t.Errorf("expected the completing hikes in date order, got %+v", trails[0].Completions)
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/toozej/trails-completionist/internal/generator"
+	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// CompletionPath is the API endpoint the HTML page marks trails complete or incomplete at
+const CompletionPath = "/api/trails/completion"
+
+// maxRequestBytes limits the size of API request bodies
+const maxRequestBytes = 1 << 16
+
+// Server serves the generated HTML page's directory, and an API which marks trails complete
+// or incomplete in the checklist and regenerates the HTML page from it
+type Server struct {
+	checklistFile string
+	htmlFile      string
+	opts          generator.Options
+	mu            sync.Mutex // held while the checklist is read, changed and written back
+}
+
+// New returns a server for the HTML page generated from the checklist. Without a checklist
+// file, the HTML page is served but trails can't be marked complete.
+func New(checklistFile, htmlFile string, opts generator.Options) *Server {
+	return &Server{checklistFile: checklistFile, htmlFile: htmlFile, opts: opts}
+}
+
+// Handler returns the handler serving the HTML page's directory and the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(filepath.Dir(s.htmlFile))))
+	mux.HandleFunc("POST "+CompletionPath, s.handleCompletion)
+	return mux
+}
+
+// CompletionRequest marks a trail, found by its name and park, complete or incomplete
+type CompletionRequest struct {
+	Name      string `json:"name"`
+	Park      string `json:"park"`
+	Completed bool   `json:"completed"`
+	Date      string `json:"date"` // completion date as YYYY-MM-DD or MM/DD/YYYY, today when empty
+}
+
+// CompletionResponse is a trail's completion once changed
+type CompletionResponse struct {
+	Name      string `json:"name"`
+	Park      string `json:"park"`
+	Completed bool   `json:"completed"`
+	Date      string `json:"date"` // in the configured date format, empty when incomplete
+}
+
+// errorResponse is the body of every API error
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("error writing response: %v", err)
+	}
+}
+
+// writeError writes an API error, logging errors which aren't the client's
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Errorf("error handling request: %v", err)
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// checkRequest rejects API requests which pages of other sites could make from the user's
+// browser: bodies which aren't JSON, which pages can post without a CORS preflight, requests
+// from pages of another origin, and requests to a local server under another host name, as
+// DNS rebinding makes. It returns the HTTP status of any error.
+func checkRequest(r *http.Request) (int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("request Content-Type must be application/json")
+	}
+
+	// Browsers send the Origin of pages posting to the API, other clients needn't
+	if origin := r.Header.Get("Origin"); origin != "" {
+		originURL, err := url.Parse(origin)
+		if err != nil || originURL.Host != r.Host {
+			return http.StatusForbidden, fmt.Errorf("requests from %s are not allowed", origin)
+		}
+	}
+
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && IsLoopback(local.String()) && !IsLoopback(r.Host) {
+		return http.StatusForbidden, fmt.Errorf("requests to a local server must be made to localhost, not %s", r.Host)
+	}
+	return http.StatusOK, nil
+}
+
+// IsLoopback checks if a host or listen address, with or without a port, is localhost or a
+// loopback address. An address without a host, such as :3000, listens on every interface.
+func IsLoopback(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleCompletion marks a trail complete or incomplete, writes the checklist back and
+// regenerates the HTML page
+func (s *Server) handleCompletion(w http.ResponseWriter, r *http.Request) {
+	if status, err := checkRequest(r); err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if s.checklistFile == "" {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no checklist file to update, set checklistFile via flag or env var"))
+		return
+	}
+
+	var req CompletionRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding request: %w", err))
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("trail name must be specified"))
+		return
+	}
+
+	var date time.Time
+	if req.Completed {
+		date = types.Day(time.Now())
+		if req.Date != "" {
+			var err error
+			date, err = parser.ParseChecklistDate(req.Date)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	date, status, err := s.setCompletion(req.Name, req.Park, req.Completed, date)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	resp := CompletionResponse{Name: req.Name, Park: req.Park, Completed: req.Completed}
+	if !date.IsZero() {
+		resp.Date = date.Format(s.opts.DateFormat)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// setCompletion marks every trail with the name in the park complete or incomplete in the
+// checklist, then regenerates the HTML page. A trail which is already completed keeps its
+// earlier completion date, as when the checklist is merged. It returns the completion date
+// recorded, and the HTTP status of any error.
+func (s *Server) setCompletion(name, park string, completed bool, date time.Time) (time.Time, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trails, err := parser.ParseTrailsFromChecklist(s.checklistFile)
+	if err != nil {
+		return date, http.StatusInternalServerError, fmt.Errorf("error reading checklist: %w", err)
+	}
+
+	found := false
+	recorded := date
+	for i := range trails {
+		if trails[i].Name != name || trails[i].Park != park {
+			continue
+		}
+		if completed && trails[i].Completed {
+			trails[i].CompletionDate = generator.EarliestDate(trails[i].CompletionDate, date, true)
+		} else {
+			trails[i].CompletionDate = date
+		}
+		trails[i].Completed = completed
+		if !found {
+			recorded = trails[i].CompletionDate
+		}
+		found = true
+	}
+	if !found {
+		return date, http.StatusNotFound, fmt.Errorf("trail %q in %q not found in the checklist", name, park)
+	}
+
+	if err := generator.WriteChecklist(s.checklistFile, trails, s.opts); err != nil {
+		return date, http.StatusInternalServerError, fmt.Errorf("error writing checklist: %w", err)
+	}
+	if err := generator.GenerateHTMLOutput(s.htmlFile, trails, s.opts); err != nil {
+		return date, http.StatusInternalServerError, fmt.Errorf("checklist updated, but error regenerating HTML output file: %w", err)
+	}
+	return recorded, http.StatusOK, nil
+}
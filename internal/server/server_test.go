@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toozej/trails-completionist/internal/generator"
+	"github.com/toozej/trails-completionist/internal/types"
+)
+
+// newTestServer writes a checklist and HTML page of two trails, returning a server for them
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	checklistFile := filepath.Join(dir, "checklist.md")
+	htmlFile := filepath.Join(dir, "trails.html")
+	opts := generator.Options{Units: types.Imperial, DateFormat: "2006-01-02"}
+	trails := []types.Trail{
+		{Name: "Wildwood Trail", Park: "Forest Park", Type: "Trail", Length: types.Miles(30.2)},
+		{Name: "Loop Trail", Park: "Mount Tabor Park", Type: "Trail", Length: types.Miles(0.9), Completed: true},
+	}
+	if err := generator.WriteChecklist(checklistFile, trails, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := generator.GenerateHTMLOutput(htmlFile, trails, opts); err != nil {
+		t.Fatal(err)
+	}
+	return New(checklistFile, htmlFile, opts), checklistFile
+}
+
+// postCompletion sends a request body to the completion API, returning the response
+func postCompletion(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, CompletionPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompletion(t *testing.T) {
+	server, checklistFile := newTestServer(t)
+	handler := server.Handler()
+
+	rec := postCompletion(t, handler, `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true, "date": "10/28/2023"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp CompletionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Completed || resp.Date != "2023-10-28" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	rec = postCompletion(t, handler, `{"name": "Loop Trail", "park": "Mount Tabor Park", "completed": false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	checklist, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "- Wildwood Trail\n    - type: Trail\n    - length: 30.2 miles\n    - completed: 2023-10-28\n"
+	if !strings.Contains(string(checklist), want) {
+		t.Errorf("expected the checklist to contain:\n%s\ngot:\n%s", want, checklist)
+	}
+	if strings.Contains(string(checklist), "completed: yes") {
+		t.Errorf("expected Loop Trail to be marked incomplete, got:\n%s", checklist)
+	}
+
+	// The checklist is replaced through a temporary file, which isn't left behind
+	if leftover, _ := filepath.Glob(filepath.Join(filepath.Dir(checklistFile), ".*.tmp")); len(leftover) > 0 {
+		t.Errorf("expected no temporary files, got %v", leftover)
+	}
+
+	// The HTML page is regenerated from the checklist
+	html, err := os.ReadFile(filepath.Join(filepath.Dir(checklistFile), "trails.html")) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "2023-10-28") {
+		t.Error("expected the regenerated HTML page to show the completion date")
+	}
+
+	// The page is served alongside the API
+	req := httptest.NewRequest(http.MethodGet, "/trails.html", nil)
+	served := httptest.NewRecorder()
+	handler.ServeHTTP(served, req)
+	if served.Code != http.StatusOK || !strings.Contains(served.Body.String(), "Wildwood Trail") {
+		t.Errorf("expected the HTML page to be served, got %d", served.Code)
+	}
+}
+
+func TestCompletion_KeepsEarlierDate(t *testing.T) {
+	server, checklistFile := newTestServer(t)
+	handler := server.Handler()
+
+	if rec := postCompletion(t, handler, `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true, "date": "2023-10-28"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Ticking a completed trail again doesn't move its completion date later
+	rec := postCompletion(t, handler, `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true, "date": "2024-05-01"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp CompletionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Date != "2023-10-28" {
+		t.Errorf("expected the earlier completion date in the response, got %+v", resp)
+	}
+
+	// An earlier date replaces it
+	if rec := postCompletion(t, handler, `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true, "date": "2023-09-01"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	checklist, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(checklist), "completed: 2023-09-01") {
+		t.Errorf("expected the earliest completion date to be kept, got:\n%s", checklist)
+	}
+}
+
+func TestCompletion_Errors(t *testing.T) {
+	server, checklistFile := newTestServer(t)
+	before, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", `{"name": `, http.StatusBadRequest},
+		{"unknown field", `{"name": "Wildwood Trail", "park": "Forest Park", "done": true}`, http.StatusBadRequest},
+		{"missing name", `{"park": "Forest Park", "completed": true}`, http.StatusBadRequest},
+		{"invalid date", `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true, "date": "yesterday"}`, http.StatusBadRequest},
+		{"unknown trail", `{"name": "Wildwood Trail", "park": "Mount Tabor Park", "completed": true}`, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := postCompletion(t, server.Handler(), test.body)
+		if rec.Code != test.want {
+			t.Errorf("%s: expected %d, got %d: %s", test.name, test.want, rec.Code, rec.Body)
+		}
+		var resp errorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error == "" {
+			t.Errorf("%s: expected a JSON error, got %v", test.name, err)
+		}
+	}
+
+	after, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected the checklist to be unchanged after failed requests, got:\n%s", after)
+	}
+
+	noChecklist := New("", filepath.Join(t.TempDir(), "trails.html"), generator.Options{})
+	if rec := postCompletion(t, noChecklist.Handler(), `{"name": "Wildwood Trail", "completed": true}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a checklist file, got %d", rec.Code)
+	}
+}
+
+func TestCompletion_OtherSites(t *testing.T) {
+	server, checklistFile := newTestServer(t)
+	before, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"name": "Wildwood Trail", "park": "Forest Park", "completed": true}`
+	loopback := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3000}
+
+	tests := []struct {
+		name        string
+		contentType string
+		origin      string
+		host        string
+		localAddr   net.Addr
+		want        int
+	}{
+		{"form post", "application/x-www-form-urlencoded", "", "localhost:3000", nil, http.StatusUnsupportedMediaType},
+		{"plain text post", "text/plain", "", "localhost:3000", nil, http.StatusUnsupportedMediaType},
+		{"missing content type", "", "", "localhost:3000", nil, http.StatusUnsupportedMediaType},
+		{"other origin", "application/json", "http://evil.example", "localhost:3000", nil, http.StatusForbidden},
+		{"opaque origin", "application/json", "null", "localhost:3000", nil, http.StatusForbidden},
+		{"DNS rebinding", "application/json", "http://evil.example:3000", "evil.example:3000", loopback, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, CompletionPath, strings.NewReader(body))
+		req.Host = test.host
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.localAddr != nil {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, test.localAddr))
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%s: expected %d, got %d: %s", test.name, test.want, rec.Code, rec.Body)
+		}
+	}
+
+	after, err := os.ReadFile(checklistFile) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected the checklist to be unchanged after rejected requests, got:\n%s", after)
+	}
+
+	// The page's own requests are accepted
+	req := httptest.NewRequest(http.MethodPost, CompletionPath, strings.NewReader(body))
+	req.Host = "localhost:3000"
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Origin", "http://localhost:3000")
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, loopback))
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a same-origin request to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:3000":   true,
+		"127.0.0.1:3000":   true,
+		"[::1]:3000":       true,
+		"localhost":        true,
+		":3000":            false,
+		"0.0.0.0:3000":     false,
+		"192.168.1.2:3000": false,
+		"evil.example":     false,
+	}
+	for addr, want := range tests {
+		if got := IsLoopback(addr); got != want {
+			t.Errorf("IsLoopback(%q) = %v, expected %v", addr, got, want)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package trailscompletionist
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
-	"path/filepath"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -11,6 +12,7 @@ import (
 	"github.com/toozej/trails-completionist/internal/generator"
 	"github.com/toozej/trails-completionist/internal/matcher"
 	"github.com/toozej/trails-completionist/internal/parser"
+	"github.com/toozej/trails-completionist/internal/server"
 	"github.com/toozej/trails-completionist/internal/types"
 	"github.com/toozej/trails-completionist/pkg/config"
 	"github.com/toozej/trails-completionist/pkg/osm"
@@ -18,7 +20,7 @@ import (
 )
 
 // RunTrailsCompletionist contains the main application logic extracted from rootCmdRun
-func RunTrailsCompletionist(config config.Config, debug bool) error {
+func RunTrailsCompletionist(ctx context.Context, config config.Config, debug bool) error {
 	if debug {
 		fmt.Printf("RunTrailsCompletionist: config struct contains: %v\n", config)
 	}
@@ -26,17 +28,27 @@ func RunTrailsCompletionist(config config.Config, debug bool) error {
 	var osmData *osm.OSMData
 	var err error
 
+	genOpts, err := generator.OptionsFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("error parsing output options: %w", err)
+	}
+
 	if config.OSMRegionFile != "" {
 		if debug {
 			fmt.Printf("Parsing OSM region file: %s\n", config.OSMRegionFile)
 		}
+		filter, err := osm.ParseTagFilter(config.OSMTagFilter)
+		if err != nil {
+			return fmt.Errorf("error parsing OSM tag filter: %w", err)
+		}
+
 		// Parse OSM region file
-		osmData, err = osm.LoadOSMData(config.OSMRegionFile, false)
+		osmData, err = osm.LoadOSMData(config.OSMRegionFile, config.Rebuild, filter)
 		if err != nil {
 			return fmt.Errorf("error loading OSM region file: %w", err)
 		}
 		if debug {
-			fmt.Printf("Loaded %d nodes and %d ways\n", len(osmData.Nodes), len(osmData.Ways))
+			fmt.Printf("Loaded %d nodes, %d ways and %d relations\n", len(osmData.Nodes), len(osmData.Ways), len(osmData.Relations))
 		}
 
 	}
@@ -57,7 +69,7 @@ func RunTrailsCompletionist(config config.Config, debug bool) error {
 		}
 
 		// Parse trails out of found GPX files
-		foundGPXTrails, err = parser.ParseTrailsFromTrackFiles(config.TrackFiles, true, osmData)
+		foundGPXTrails, err = parser.ParseTrailsFromTrackFiles(ctx, config.TrackFiles, true, osmData, parser.MatchOptionsFromConfig(config))
 		if err != nil {
 			return fmt.Errorf("error parsing trails from track files: %w", err)
 		}
@@ -90,7 +102,11 @@ func RunTrailsCompletionist(config config.Config, debug bool) error {
 	// Merge together rawTrails and foundGPXTrails
 	// checking for duplicates, and preferring foundGPXTrails over rawTrails
 	// (a.k.a. completed trails over not completed)
-	combinedTrails, err := matcher.MatchTrails(foundGPXTrails, rawTrails)
+	matchOpts, err := matcher.OptionsFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("error loading trail name aliases: %w", err)
+	}
+	combinedTrails, err := matcher.MatchTrails(foundGPXTrails, rawTrails, matchOpts)
 	if err != nil {
 		fmt.Println(fmt.Errorf("error matching trails: %w", err))
 	}
@@ -98,7 +114,7 @@ func RunTrailsCompletionist(config config.Config, debug bool) error {
 		fmt.Printf("Combined and de-duplicated list of trails:\n %v\n", combinedTrails)
 	}
 
-	if err = generator.GenerateChecklist(config.ChecklistFile, combinedTrails); err != nil {
+	if err = generator.GenerateChecklist(config.ChecklistFile, combinedTrails, genOpts); err != nil {
 		return fmt.Errorf("error generating checklist: %w", err)
 	}
 
@@ -112,28 +128,42 @@ func RunTrailsCompletionist(config config.Config, debug bool) error {
 		log.Println(trails)
 	}
 
-	// Generate HTML table from checklist
-	if err = generator.GenerateHTMLOutput(config.HTMLFile, trails); err != nil {
+	// Generate HTML table and map from checklist
+	genOpts.OSMData = osmData
+	if err = generator.GenerateHTMLOutput(config.HTMLFile, trails, genOpts); err != nil {
 		return fmt.Errorf("error generating HTML output file: %w", err)
 	} else if config.Serve {
-		return ServeHTMLFile(config.HTMLFile)
+		return ServeHTMLFile(config.ServeAddr, config.ChecklistFile, config.HTMLFile, genOpts)
 	}
 
 	return nil
 }
 
-// serveHTMLFile serves the generated HTML file on port 3000
-func ServeHTMLFile(htmlFile string) error {
-	htmlDir := filepath.Dir(htmlFile)
-	http.Handle("/", http.FileServer(http.Dir(htmlDir)))
-	server := &http.Server{
-		Addr:         ":3000",
+// ServeHTMLFile serves the generated HTML file on the given address, along with the API its
+// checkboxes use to mark trails complete or incomplete in the checklist file
+func ServeHTMLFile(addr, checklistFile, htmlFile string, genOpts generator.Options) error {
+	httpServer := &http.Server{
+		Addr:         addr,
+		Handler:      server.New(checklistFile, htmlFile, genOpts).Handler(),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
-	log.Printf("Serving HTML file at http://localhost:3000/")
-	if err := server.ListenAndServe(); err != nil {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("error parsing serve address %s: %w", addr, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	log.Printf("Serving HTML file at http://%s/", net.JoinHostPort(host, port))
+	if checklistFile != "" && !server.IsLoopback(addr) {
+		log.Printf("Warning: serving on %s, so anyone who can connect to it can mark trails complete", addr)
+	}
+	if checklistFile == "" {
+		log.Printf("No checklist file specified, so trails can't be marked complete from the HTML file")
+	}
+	if err := httpServer.ListenAndServe(); err != nil {
 		return fmt.Errorf("error serving generated HTML file: %w", err)
 	}
 
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Distance is a length in meters. Zero means the length is unknown.
+type Distance float64
+
+// Distance units
+const (
+	Meter     Distance = 1
+	Kilometer Distance = 1000
+	Mile      Distance = 1609.344
+	Foot      Distance = 0.3048
+)
+
+// Miles returns a distance of the given number of miles
+func Miles(miles float64) Distance {
+	return Distance(miles) * Mile
+}
+
+// Miles returns the distance in miles
+func (d Distance) Miles() float64 {
+	return float64(d / Mile)
+}
+
+// Kilometers returns the distance in kilometers
+func (d Distance) Kilometers() float64 {
+	return float64(d / Kilometer)
+}
+
+// UnitSystem selects the units distances are written in
+type UnitSystem string
+
+const (
+	Imperial UnitSystem = "imperial"
+	Metric   UnitSystem = "metric"
+)
+
+// ParseUnitSystem parses "imperial" or "metric", defaulting to imperial when empty
+func ParseUnitSystem(input string) (UnitSystem, error) {
+	switch UnitSystem(strings.ToLower(strings.TrimSpace(input))) {
+	case "", Imperial:
+		return Imperial, nil
+	case Metric:
+		return Metric, nil
+	default:
+		return "", fmt.Errorf("unknown unit system %q, expected imperial or metric", input)
+	}
+}
+
+// Format writes the distance to a tenth of a mile, or a tenth of a kilometer for metric units
+func (d Distance) Format(units UnitSystem) string {
+	if units == Metric {
+		return fmt.Sprintf("%.1f km", d.Kilometers())
+	}
+	return fmt.Sprintf("%.1f miles", d.Miles())
+}
+
+// distanceUnits maps the unit names accepted by ParseDistance to their lengths
+var distanceUnits = map[string]Distance{
+	"mi":         Mile,
+	"mile":       Mile,
+	"miles":      Mile,
+	"km":         Kilometer,
+	"kilometer":  Kilometer,
+	"kilometers": Kilometer,
+	"kilometre":  Kilometer,
+	"kilometres": Kilometer,
+	"ft":         Foot,
+	"foot":       Foot,
+	"feet":       Foot,
+	"m":          Meter,
+	"meter":      Meter,
+	"meters":     Meter,
+	"metre":      Meter,
+	"metres":     Meter,
+}
+
+// distanceRegex matches a number followed by an optional unit
+var distanceRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?|\.\d+)\s*([a-zA-Z]*)$`)
+
+// ParseDistance parses a distance such as "7.3 miles", "12 km", "500ft", "300 m" or "0.4 mi".
+// A number without a unit is taken to be miles.
+func ParseDistance(input string) (Distance, error) {
+	match := distanceRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return 0, fmt.Errorf("invalid distance %q", input)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid distance %q: %w", input, err)
+	}
+
+	unit := Mile
+	if match[2] != "" {
+		var ok bool
+		if unit, ok = distanceUnits[strings.ToLower(match[2])]; !ok {
+			return 0, fmt.Errorf("unknown distance unit %q in %q", match[2], input)
+		}
+	}
+	return Distance(value) * unit, nil
+}
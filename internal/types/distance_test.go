@@ -0,0 +1,54 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseDistance(t *testing.T) {
+	tests := []struct {
+		input string
+		miles float64
+	}{
+		{"7.3 miles", 7.3},
+		{"1 mile", 1},
+		{"0.4 mi", 0.4},
+		{"0.4", 0.4},
+		{"1.609344 km", 1},
+		{"5280 ft", 1},
+		{"5280ft", 1},
+		{"1609.344 meters", 1},
+		{"1609.344 m", 1},
+		{"1609.344m", 1},
+	}
+	for _, test := range tests {
+		got, err := ParseDistance(test.input)
+		if err != nil {
+			t.Errorf("ParseDistance(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if math.Abs(got.Miles()-test.miles) > 1e-9 {
+			t.Errorf("ParseDistance(%q) = %v miles, want %v", test.input, got.Miles(), test.miles)
+		}
+	}
+
+	for _, input := range []string{"", "miles", "3 furlongs", "-1 km"} {
+		if _, err := ParseDistance(input); err == nil {
+			t.Errorf("ParseDistance(%q) expected an error", input)
+		}
+	}
+}
+
+func TestDistanceFormat(t *testing.T) {
+	d := Miles(7.3)
+	if got := d.Format(Imperial); got != "7.3 miles" {
+		t.Errorf("Format(Imperial) = %q, want %q", got, "7.3 miles")
+	}
+	if got := d.Format(Metric); got != "11.7 km" {
+		t.Errorf("Format(Metric) = %q, want %q", got, "11.7 km")
+	}
+
+	if _, err := ParseUnitSystem("nautical"); err == nil {
+		t.Error("ParseUnitSystem(\"nautical\") expected an error")
+	}
+}
@@ -1,16 +1,111 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Trail represents information about a hiking trail
 type Trail struct {
-	Name           string
-	Park           string
-	Type           string
-	Length         string
-	URL            string
-	Completed      bool
-	CompletionDate string
+	Name              string
+	Park              string
+	Type              string
+	Length            Distance
+	URL               string
+	Completed         bool
+	CompletionDate    time.Time      // day the trail was completed, zero if it isn't or the day is unknown
+	PercentComplete   float64        // percentage of the trail's length covered by GPX tracks
+	UncoveredSegments []TrailSegment // stretches of the trail not yet covered by GPX tracks
+	Completions       []Completion   // hikes which completed the trail, earliest first
+	OSMId             int64          // OSM way or relation the trail was found as in GPX tracks
+	OSMType           string         // way or relation
+	Unlisted          bool           // found in GPX tracks, but not in the raw input list
+	Tags              []string       // labels added to the checklist by hand
+	Notes             []string       // free-form notes added to the checklist by hand
+}
+
+// Completion is a hike which completed a trail, covering at least the completion threshold of it
+type Completion struct {
+	Date       time.Time // day of the hike, see Day
+	SourceFile string    // GPX file the hike was recorded in
+}
+
+// HikeCount returns how many times the trail has been hiked to completion
+func (t Trail) HikeCount() int {
+	return len(t.Completions)
+}
+
+// LastHiked returns the date of the most recent hike completing the trail, or the zero time if there is none
+func (t Trail) LastHiked() time.Time {
+	if len(t.Completions) == 0 {
+		return time.Time{}
+	}
+	return t.Completions[len(t.Completions)-1].Date
+}
+
+// OSMURL returns the address of the trail's OSM way or relation, or "" if it wasn't found in OSM
+func (t Trail) OSMURL() string {
+	if t.OSMId == 0 || t.OSMType == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://www.openstreetmap.org/%s/%d", t.OSMType, t.OSMId)
+}
+
+// Link returns the trail's URL, falling back to its OSM way or relation, or "" if it has neither
+func (t Trail) Link() string {
+	if t.URL != "" {
+		return t.URL
+	}
+	return t.OSMURL()
+}
+
+// Day returns midnight UTC on the calendar day of t, so dates read back from the
+// checklist compare equal to the dates of the GPX tracks they were written from
+func Day(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// TrailSegment is a stretch of a trail, measured in miles from the start of one of the
+// trail's polylines. Most trails are a single polyline, branching trails have several.
+type TrailSegment struct {
+	Polyline int
+	Start    float64
+	End      float64
+}
+
+// String formats the segment as "1.2-3.4 mi", prefixed with "part N: " for all but the first polyline
+func (s TrailSegment) String() string {
+	if s.Polyline > 0 {
+		return fmt.Sprintf("part %d: %.1f-%.1f mi", s.Polyline+1, s.Start, s.End)
+	}
+	return fmt.Sprintf("%.1f-%.1f mi", s.Start, s.End)
+}
+
+// trailSegmentRegex matches the format written by TrailSegment.String
+var trailSegmentRegex = regexp.MustCompile(`^(?:part (\d+): )?(\d+(?:\.\d+)?)-(\d+(?:\.\d+)?) mi$`)
+
+// ParseTrailSegment parses a segment in the format written by TrailSegment.String
+func ParseTrailSegment(input string) (TrailSegment, error) {
+	match := trailSegmentRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return TrailSegment{}, fmt.Errorf("invalid trail segment %q", input)
+	}
+
+	var segment TrailSegment
+	if match[1] != "" {
+		part, _ := strconv.Atoi(match[1])
+		segment.Polyline = part - 1
+	}
+	segment.Start, _ = strconv.ParseFloat(match[2], 64)
+	segment.End, _ = strconv.ParseFloat(match[3], 64)
+	return segment, nil
 }
 
 // Point represents a geographical point
@@ -21,11 +116,19 @@ type Point struct {
 
 // TrailMatch represents a potential match between GPX track and OSM trail
 type TrailMatch struct {
-	Name       string
-	Type       string
-	Length     float64
-	Similarity float64
-	OSMId      int64
+	Name          string
+	Park          string // park containing most of the trail, from OSM park boundaries
+	Type          string
+	Length        float64
+	Similarity    float64
+	Coverage      float64 // percentage of the trail's length within the match distance of the track
+	CoveredLength float64 // miles of the trail within the match distance of the track
+	// CoveredSegments and PolylineLengths (in miles) locate the covered stretches, so
+	// coverage of the same trail by several tracks can be combined
+	CoveredSegments []TrailSegment
+	PolylineLengths []float64
+	OSMId           int64
+	OSMType         string // way or relation
 }
 
 // TrailResult stores the complete processing result for a GPX file
@@ -33,4 +136,12 @@ type TrailResult struct {
 	Filename   string
 	TravelDate time.Time
 	Matches    []TrailMatch
+	Candidates []TrailCandidate // every nearby trail considered, only recorded when explaining matches
+}
+
+// TrailCandidate records whether a nearby OSM trail was matched to a GPX track, and why
+type TrailCandidate struct {
+	Match    TrailMatch
+	Accepted bool
+	Reason   string
 }
@@ -0,0 +1,19 @@
+package types
+
+import "testing"
+
+func TestTrailLink(t *testing.T) {
+	trail := Trail{Name: "Wildwood Trail", OSMType: "relation", OSMId: 6543210}
+	if got, want := trail.Link(), "https://www.openstreetmap.org/relation/6543210"; got != want {
+		t.Errorf("Link() = %q, want %q", got, want)
+	}
+
+	trail.URL = "https://example.com/wildwood"
+	if got := trail.Link(); got != trail.URL {
+		t.Errorf("Link() = %q, want the trail's own URL %q", got, trail.URL)
+	}
+
+	if got := (Trail{Name: "Unmapped Trail"}).Link(); got != "" {
+		t.Errorf("Link() = %q, want no link", got)
+	}
+}
@@ -44,16 +44,39 @@ import (
 //
 // Configuration parameters:
 //   - OSMRegionFile: Path to OSM region file for trail data
+//   - OSMTagFilter: Tags of OSM features to keep when loading the OSM region file
 //   - TrackFiles: Path to directory containing GPX track files
 //   - InputFile: Path to input file containing trail information
 //   - ChecklistFile: Path to output checklist file
 //   - HTMLFile: Path to output HTML file
 //   - Serve: Whether to serve the generated HTML file
+//   - ServeAddr: Address the HTML file and its API are served on
+//   - CompletionThreshold: Percentage of a trail GPX tracks must cover to complete it
+//   - MatchBBoxBuffer, MatchDistance, MatchSampleSpacing, MatchMinCoverage,
+//     MatchMinCoveredLength, MatchMaxResults: Tuning for matching GPX tracks to OSM trails
+//   - Workers: Number of GPX files processed at once
+//   - ResultsCacheDir: Directory the results of processing each GPX file are cached in
+//   - Rebuild: Whether to ignore the OSM and GPX results caches and rebuild them
+//   - AliasFile: Path to file mapping GPX trail names to names in the input file
+//   - NameMatchThreshold: Minimum similarity for a GPX trail name to match an input trail name
+//   - IncludeUnlisted: Whether to include GPX trails missing from the input file in an Unlisted section
+//   - Units: Units trail lengths are written in, imperial or metric
+//   - DateFormat: Go time layout dates are written in to the checklist and HTML file
+//   - MapTileDir: Optional directory of map tiles for the HTML file's map
+//   - ParkOrder: Order parks are written in, by name, completion or length
+//   - TrailOrder: Order trails are written in within each park, by name or length
+//   - Region: Region the checklist and HTML file are titled with
+//   - TemplateDir: Optional directory of templates, CSS and JS files overriding the defaults
 type Config struct {
 	// OSMRegionFile specifies the path to the OSM region file.
 	// It is loaded from the OSM_REGION_FILE environment variable.
 	OSMRegionFile string `env:"OSM_REGION_FILE"`
 
+	// OSMTagFilter specifies which OSM features to keep when loading the OSM region file,
+	// in the form "key=value|value,key". Empty keeps trails, hiking routes and parks, "*" keeps everything.
+	// It is loaded from the OSM_TAG_FILTER environment variable.
+	OSMTagFilter string `env:"OSM_TAG_FILTER"`
+
 	// TrackFiles specifies the path to the directory containing GPX track files.
 	// It is loaded from the TRACK_FILES environment variable.
 	TrackFiles string `env:"TRACK_FILES"`
@@ -73,6 +96,111 @@ type Config struct {
 	// Serve specifies whether to serve the generated HTML file.
 	// It is loaded from the SERVE environment variable.
 	Serve bool `env:"SERVE"`
+
+	// ServeAddr specifies the address the HTML file, and the API marking trails complete
+	// from it, are served on. Only this machine can connect to the default; an address
+	// without a host, such as ":3000", lets anyone on the network mark trails complete.
+	// It is loaded from the SERVE_ADDR environment variable, defaulting to localhost:3000.
+	ServeAddr string `env:"SERVE_ADDR" envDefault:"localhost:3000"`
+
+	// CompletionThreshold specifies the percentage of a trail's length which GPX
+	// tracks must cover before the trail is marked completed.
+	// It is loaded from the COMPLETION_THRESHOLD environment variable, defaulting to 90.
+	CompletionThreshold float64 `env:"COMPLETION_THRESHOLD" envDefault:"90"`
+
+	// MatchBBoxBuffer specifies the buffer in degrees added around each GPX track
+	// when searching the OSM data for nearby trails.
+	// It is loaded from the MATCH_BBOX_BUFFER environment variable, defaulting to 0.005 (~500m).
+	MatchBBoxBuffer float64 `env:"MATCH_BBOX_BUFFER" envDefault:"0.005"`
+
+	// MatchDistance specifies how close in meters a trail must be to a GPX track to count as walked.
+	// It is loaded from the MATCH_DISTANCE environment variable, defaulting to 25.
+	MatchDistance float64 `env:"MATCH_DISTANCE" envDefault:"25"`
+
+	// MatchSampleSpacing specifies the spacing in meters of the points checked along each trail.
+	// It is loaded from the MATCH_SAMPLE_SPACING environment variable, defaulting to 5.
+	MatchSampleSpacing float64 `env:"MATCH_SAMPLE_SPACING" envDefault:"5"`
+
+	// MatchMinCoverage specifies the percentage of a trail's length a GPX track must walk to match it.
+	// It is loaded from the MATCH_MIN_COVERAGE environment variable, defaulting to 50.
+	MatchMinCoverage float64 `env:"MATCH_MIN_COVERAGE" envDefault:"50"`
+
+	// MatchMinCoveredLength specifies the length in meters of a trail a GPX track must walk
+	// to match it regardless of coverage, so long trails walked in part still match.
+	// It is loaded from the MATCH_MIN_COVERED_LENGTH environment variable, defaulting to 160.
+	MatchMinCoveredLength float64 `env:"MATCH_MIN_COVERED_LENGTH" envDefault:"160"`
+
+	// MatchMaxResults specifies the most trails matched to a single GPX track, 0 for no limit.
+	// It is loaded from the MATCH_MAX_RESULTS environment variable, defaulting to 5.
+	MatchMaxResults int `env:"MATCH_MAX_RESULTS" envDefault:"5"`
+
+	// Workers specifies how many GPX files are processed at once, 0 for one per CPU.
+	// It is loaded from the WORKERS environment variable.
+	Workers int `env:"WORKERS"`
+
+	// ResultsCacheDir specifies the directory the results of processing each GPX file are
+	// cached in, so unchanged files aren't processed again. Empty uses the user cache directory.
+	// It is loaded from the RESULTS_CACHE_DIR environment variable.
+	ResultsCacheDir string `env:"RESULTS_CACHE_DIR"`
+
+	// Rebuild specifies whether to discard the OSM binary cache and cached GPX results,
+	// and rebuild them from scratch.
+	// It is loaded from the REBUILD environment variable.
+	Rebuild bool `env:"REBUILD"`
+
+	// AliasFile specifies the path to a file of trail name aliases, one "GPX name = listed name"
+	// per line, for GPX trails whose names don't resemble their names in the input file.
+	// It is loaded from the ALIAS_FILE environment variable.
+	AliasFile string `env:"ALIAS_FILE"`
+
+	// NameMatchThreshold specifies how similar, from 0 to 1, a GPX trail's normalized name must
+	// be to a trail name in the input file to match it.
+	// It is loaded from the NAME_MATCH_THRESHOLD environment variable, defaulting to 0.85.
+	NameMatchThreshold float64 `env:"NAME_MATCH_THRESHOLD" envDefault:"0.85"`
+
+	// IncludeUnlisted specifies whether trails found in GPX tracks but missing from the input
+	// file are added to an Unlisted section of the checklist and HTML file.
+	// It is loaded from the INCLUDE_UNLISTED environment variable.
+	IncludeUnlisted bool `env:"INCLUDE_UNLISTED"`
+
+	// Units specifies whether trail lengths are written to the checklist and HTML file
+	// in miles ("imperial") or kilometers ("metric").
+	// It is loaded from the UNITS environment variable, defaulting to imperial.
+	Units string `env:"UNITS" envDefault:"imperial"`
+
+	// DateFormat specifies the Go time layout completion and hike dates are written in to
+	// the checklist and HTML file, such as 01/02/2006 or 2006-01-02 for ISO 8601.
+	// It is loaded from the DATE_FORMAT environment variable, defaulting to 01/02/2006.
+	DateFormat string `env:"DATE_FORMAT" envDefault:"01/02/2006"`
+
+	// MapTileDir specifies an optional directory of map tiles, laid out as {z}/{x}/{y}.png,
+	// drawn under the trails on the HTML file's map. It must be inside the HTML file's
+	// directory so it is served with the page.
+	// It is loaded from the MAP_TILE_DIR environment variable.
+	MapTileDir string `env:"MAP_TILE_DIR"`
+
+	// ParkOrder specifies the order parks are written to the checklist and HTML file in:
+	// alphabetically ("name"), most completed first ("completion") or most miles of trail
+	// first ("length").
+	// It is loaded from the PARK_ORDER environment variable, defaulting to name.
+	ParkOrder string `env:"PARK_ORDER" envDefault:"name"`
+
+	// TrailOrder specifies the order trails are written in within each park:
+	// alphabetically ("name") or longest first ("length").
+	// It is loaded from the TRAIL_ORDER environment variable, defaulting to name.
+	TrailOrder string `env:"TRAIL_ORDER" envDefault:"name"`
+
+	// Region specifies the region the trails are in, which the checklist and HTML file
+	// are titled with, as in "PDX Trails Completionist".
+	// It is loaded from the REGION environment variable, defaulting to PDX.
+	Region string `env:"REGION" envDefault:"PDX"`
+
+	// TemplateDir specifies an optional directory of checklist.md.tmpl, trails.html.tmpl,
+	// CSS and JS files used instead of the embedded defaults. Files missing from it fall
+	// back to the defaults, and other *.md.tmpl, *.html.tmpl, *.css and *.js files in it
+	// are used too.
+	// It is loaded from the TEMPLATE_DIR environment variable.
+	TemplateDir string `env:"TEMPLATE_DIR"`
 }
 
 // GetEnvVars loads and returns the application configuration from environment
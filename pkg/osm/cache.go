@@ -0,0 +1,246 @@
+package osm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheFormatVersion is the version of the binary cache layout. It must be
+// bumped whenever OSMData or any of its field types change, so that caches
+// written by older versions are rebuilt instead of decoded into the wrong shape.
+// Version 1 was the original headerless gob cache, version 2 added the header,
+// and version 3 added park areas.
+const CacheFormatVersion = 3
+
+// cacheMagic identifies a versioned binary cache file. Caches written before
+// the header was added start directly with gob data, and are always rebuilt.
+var cacheMagic = []byte("TCOSMBIN")
+
+// maxCacheHeaderSize guards against reading a garbage header length
+const maxCacheHeaderSize = 64 * 1024
+
+// CacheHeader describes a binary cache file, and what it was built from
+type CacheHeader struct {
+	FormatVersion int
+	SourceFile    string
+	SourceSize    int64
+	SourceSHA256  string
+	TagFilter     string
+	DataSHA256    string
+	CreatedAt     time.Time
+	Nodes         int
+	Ways          int
+	Relations     int
+}
+
+// CachePath returns the binary cache file path for an OSM file
+func CachePath(osmFilePath string) string {
+	return osmFilePath + ".bin"
+}
+
+// hashFile returns the size and hex-encoded SHA-256 hash of a file
+func hashFile(filePath string) (int64, string, error) {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// ReadCacheHeader reads just the header of a binary cache file
+func ReadCacheHeader(binaryPath string) (*CacheHeader, error) {
+	file, err := os.Open(binaryPath) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("binary cache doesn't exist")
+	}
+	defer file.Close()
+
+	return readCacheHeader(bufio.NewReader(file))
+}
+
+// readCacheHeader reads the magic bytes and header from the start of a binary cache
+func readCacheHeader(reader io.Reader) (*CacheHeader, error) {
+	magic := make([]byte, len(cacheMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, cacheMagic) {
+		return nil, fmt.Errorf("binary cache has no header, it was written by an older version")
+	}
+
+	var headerSize uint32
+	if err := binary.Read(reader, binary.BigEndian, &headerSize); err != nil {
+		return nil, fmt.Errorf("error reading binary cache header size: %w", err)
+	}
+	if headerSize > maxCacheHeaderSize {
+		return nil, fmt.Errorf("binary cache header too large: %d bytes", headerSize)
+	}
+
+	headerBytes := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader, headerBytes); err != nil {
+		return nil, fmt.Errorf("error reading binary cache header: %w", err)
+	}
+
+	var header CacheHeader
+	if err := gob.NewDecoder(bytes.NewReader(headerBytes)).Decode(&header); err != nil {
+		return nil, fmt.Errorf("error decoding binary cache header: %w", err)
+	}
+	return &header, nil
+}
+
+// checkCacheHeader checks that a cache header matches the current format version,
+// the OSM source file and the tag filter
+func checkCacheHeader(header *CacheHeader, osmFilePath string, filter TagFilter) error {
+	if header.FormatVersion != CacheFormatVersion {
+		return fmt.Errorf("binary cache format version %d is incompatible with version %d", header.FormatVersion, CacheFormatVersion)
+	}
+
+	if header.TagFilter != filter.String() {
+		return fmt.Errorf("binary cache was built with tag filter %s, not %s", header.TagFilter, filter)
+	}
+
+	sourceInfo, err := os.Stat(osmFilePath)
+	if err != nil {
+		return fmt.Errorf("can't access original OSM file: %w", err)
+	}
+	if sourceInfo.Size() != header.SourceSize {
+		return fmt.Errorf("binary cache is outdated, OSM file size has changed")
+	}
+
+	_, sourceHash, err := hashFile(osmFilePath)
+	if err != nil {
+		return fmt.Errorf("error hashing original OSM file: %w", err)
+	}
+	if sourceHash != header.SourceSHA256 {
+		return fmt.Errorf("binary cache is outdated, OSM file contents have changed")
+	}
+
+	return nil
+}
+
+// VerifyCache fully checks the binary cache for an OSM file, including the
+// checksum of the cached data, and returns its header
+func VerifyCache(osmFilePath string, filter TagFilter) (*CacheHeader, error) {
+	_, header, err := tryLoadBinary(osmFilePath, CachePath(osmFilePath), filter)
+	return header, err
+}
+
+// tryLoadBinary attempts to load OSM data from the binary cache file, returning
+// an error if the cache is missing, corrupt or doesn't match the OSM file and filter
+func tryLoadBinary(osmFilePath, binaryPath string, filter TagFilter) (*OSMData, *CacheHeader, error) {
+	file, err := os.Open(binaryPath) // #nosec G304
+	if err != nil {
+		return nil, nil, fmt.Errorf("binary cache doesn't exist")
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, err := readCacheHeader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkCacheHeader(header, osmFilePath, filter); err != nil {
+		return nil, header, err
+	}
+
+	// Load the binary data, hashing it as it is decoded
+	fmt.Println("Loading OSM map data from binary cache...")
+	hasher := sha256.New()
+	tee := io.TeeReader(reader, hasher)
+
+	var osmData OSMData
+	if err := gob.NewDecoder(tee).Decode(&osmData); err != nil {
+		return nil, header, fmt.Errorf("error decoding binary data: %w", err)
+	}
+	if _, err := io.Copy(hasher, tee); err != nil {
+		return nil, header, fmt.Errorf("error reading binary data: %w", err)
+	}
+
+	if hex.EncodeToString(hasher.Sum(nil)) != header.DataSHA256 {
+		return nil, header, fmt.Errorf("binary cache checksum mismatch, the file is corrupt")
+	}
+
+	osmData.checksum = header.DataSHA256
+	return &osmData, header, nil
+}
+
+// saveToBinary saves the OSM data to a binary file, as a header followed by the gob encoded data
+func saveToBinary(osmData *OSMData, osmFilePath, binaryPath string, filter TagFilter) error {
+	sourceSize, sourceHash, err := hashFile(osmFilePath)
+	if err != nil {
+		return fmt.Errorf("error hashing original OSM file: %w", err)
+	}
+
+	// Encode the data first, so its checksum can go in the header
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(osmData); err != nil {
+		return fmt.Errorf("error encoding data: %w", err)
+	}
+	dataHash := sha256.Sum256(data.Bytes())
+
+	header := CacheHeader{
+		FormatVersion: CacheFormatVersion,
+		SourceFile:    filepath.Base(osmFilePath),
+		SourceSize:    sourceSize,
+		SourceSHA256:  sourceHash,
+		TagFilter:     filter.String(),
+		DataSHA256:    hex.EncodeToString(dataHash[:]),
+		CreatedAt:     time.Now().UTC(),
+		Nodes:         len(osmData.Nodes),
+		Ways:          len(osmData.Ways),
+		Relations:     len(osmData.Relations),
+	}
+	var headerBytes bytes.Buffer
+	if err := gob.NewEncoder(&headerBytes).Encode(header); err != nil {
+		return fmt.Errorf("error encoding header: %w", err)
+	}
+
+	// Write to a temporary file first, so an interrupted save never leaves a partial cache
+	tmpPath := binaryPath + ".tmp"
+	file, err := os.Create(tmpPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error creating binary file: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	_, err = writer.Write(cacheMagic)
+	if err == nil {
+		err = binary.Write(writer, binary.BigEndian, uint32(headerBytes.Len())) // #nosec G115
+	}
+	if err == nil {
+		_, err = writer.Write(headerBytes.Bytes())
+	}
+	if err == nil {
+		_, err = writer.Write(data.Bytes())
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error writing binary file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, binaryPath); err != nil {
+		return fmt.Errorf("error replacing binary file: %w", err)
+	}
+	osmData.checksum = header.DataSHA256
+	return nil
+}
@@ -0,0 +1,212 @@
+package osm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TagFilter selects which OSM ways and relations are kept when loading OSM data.
+// It maps a tag key to its accepted values, where an empty list accepts any value.
+// A nil TagFilter keeps everything.
+type TagFilter map[string][]string
+
+// DefaultTagFilter keeps trail-like highways, hiking routes and park boundaries
+var DefaultTagFilter = TagFilter{
+	"highway":  {"path", "footway", "track", "bridleway", "steps"},
+	"route":    {"hiking", "foot"},
+	"leisure":  {"park", "nature_reserve"},
+	"boundary": {"protected_area", "national_park"},
+}
+
+// ParseTagFilter parses a tag filter of the form "key=value|value,key=value,key".
+// A key without values accepts any value for that key. An empty string returns
+// the DefaultTagFilter, and "*" returns a nil filter which keeps everything.
+func ParseTagFilter(input string) (TagFilter, error) {
+	input = strings.TrimSpace(input)
+	switch input {
+	case "":
+		return DefaultTagFilter, nil
+	case "*":
+		return nil, nil
+	}
+
+	filter := make(TagFilter)
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, values, hasValues := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter entry %q: missing key", entry)
+		}
+
+		var accepted []string
+		if hasValues {
+			for _, value := range strings.Split(values, "|") {
+				if value = strings.TrimSpace(value); value != "" {
+					accepted = append(accepted, value)
+				}
+			}
+			if len(accepted) == 0 {
+				return nil, fmt.Errorf("invalid tag filter entry %q: missing values", entry)
+			}
+		}
+		filter[key] = append(filter[key], accepted...)
+	}
+
+	return filter, nil
+}
+
+// String formats the filter in the form accepted by ParseTagFilter, with keys
+// and values sorted so equal filters always format the same way
+func (f TagFilter) String() string {
+	if f == nil {
+		return "*"
+	}
+
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string{}, f[key]...)
+		sort.Strings(values)
+		if len(values) == 0 {
+			entries = append(entries, key)
+		} else {
+			entries = append(entries, key+"="+strings.Join(values, "|"))
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// Matches checks if any of the given tags is accepted by the filter
+func (f TagFilter) Matches(tags map[string]string) bool {
+	if f == nil {
+		return true
+	}
+
+	for key, value := range tags {
+		accepted, ok := f[key]
+		if !ok {
+			continue
+		}
+		if len(accepted) == 0 {
+			return true
+		}
+		for _, v := range accepted {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodePass is one pass over an OSM file while it is decoded with a tag filter
+type decodePass int
+
+const (
+	passAll       decodePass = iota // keeps everything, for a nil filter
+	passRelations                   // keeps relations accepted by the filter
+	passWays                        // keeps ways accepted by the filter, or members of kept relations
+	passNodes                       // keeps nodes referenced by kept ways
+)
+
+// decodeFilter applies a TagFilter while an OSM file is decoded, so features
+// which would be dropped are never held in memory. Ways which are members of a
+// kept relation are kept too, since park boundary relations are usually made
+// of untagged ways, and nodes are kept only if a kept way references them.
+// Since that needs relations before ways and ways before nodes, which is the
+// reverse of their order in OSM files, a filtered file is decoded in three
+// passes, each keeping one feature type.
+type decodeFilter struct {
+	filter     TagFilter
+	pass       decodePass
+	memberWays map[int64]bool // ways of kept relations
+	wayNodes   map[int64]bool // nodes of kept ways
+}
+
+// newDecodeFilter returns a decodeFilter applying the tag filter
+func newDecodeFilter(filter TagFilter) *decodeFilter {
+	return &decodeFilter{
+		filter:     filter,
+		memberWays: make(map[int64]bool),
+		wayNodes:   make(map[int64]bool),
+	}
+}
+
+// passes returns the passes the file must be decoded in
+func (d *decodeFilter) passes() []decodePass {
+	if d.filter == nil {
+		return []decodePass{passAll}
+	}
+	return []decodePass{passRelations, passWays, passNodes}
+}
+
+// wantsNodes checks if the current pass keeps any nodes, so they can be skipped undecoded
+func (d *decodeFilter) wantsNodes() bool {
+	return d.pass == passAll || d.pass == passNodes
+}
+
+// wantsWays checks if the current pass keeps any ways, so they can be skipped undecoded
+func (d *decodeFilter) wantsWays() bool {
+	return d.pass == passAll || d.pass == passWays
+}
+
+// wantsRelations checks if the current pass keeps any relations, so they can be skipped undecoded
+func (d *decodeFilter) wantsRelations() bool {
+	return d.pass == passAll || d.pass == passRelations
+}
+
+// keepNode checks if a decoded node is kept
+func (d *decodeFilter) keepNode(node OSMNode) bool {
+	switch d.pass {
+	case passAll:
+		return true
+	case passNodes:
+		return d.wayNodes[node.ID]
+	}
+	return false
+}
+
+// keepWay checks if a decoded way is kept, recording its nodes if so
+func (d *decodeFilter) keepWay(way OSMWay) bool {
+	switch d.pass {
+	case passAll:
+		return true
+	case passWays:
+		if !d.memberWays[way.ID] && !d.filter.Matches(way.Tags) {
+			return false
+		}
+		for _, nodeID := range way.Nodes {
+			d.wayNodes[nodeID] = true
+		}
+		return true
+	}
+	return false
+}
+
+// keepRelation checks if a decoded relation is kept, recording its member ways if so
+func (d *decodeFilter) keepRelation(relation OSMRelation) bool {
+	switch d.pass {
+	case passAll:
+		return true
+	case passRelations:
+		if !d.filter.Matches(relation.Tags) {
+			return false
+		}
+		for _, wayID := range relation.WayIDs() {
+			d.memberWays[wayID] = true
+		}
+		return true
+	}
+	return false
+}
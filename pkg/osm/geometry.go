@@ -0,0 +1,41 @@
+package osm
+
+// TrailGeometry returns the polylines of a trail as [lon, lat] points, looked up by the
+// OSM type and ID a trail was matched as: the ways of a route relation, or a way stitched
+// together with the connected ways sharing its name, using IncludeTrailWay as GPX matching does.
+// It returns nil if the trail isn't in the OSM data.
+func (d *OSMData) TrailGeometry(osmType string, id int64) [][][2]float64 {
+	var polylines [][]int64
+	switch osmType {
+	case "relation":
+		relation, exists := d.Relations[id]
+		if !exists {
+			return nil
+		}
+		polylines = d.ChainWays(relation.WayIDs())
+	case "way":
+		trails := d.StitchWays([]int64{id}, d.IncludeTrailWay)
+		if len(trails) == 0 {
+			// a way which isn't stitched is its own trail
+			if way, exists := d.Ways[id]; exists {
+				polylines = [][]int64{way.Nodes}
+			}
+		} else {
+			polylines = trails[0].Polylines
+		}
+	}
+
+	var geometry [][][2]float64
+	for _, polyline := range polylines {
+		var points [][2]float64
+		for _, nodeID := range polyline {
+			if node, exists := d.Nodes[nodeID]; exists {
+				points = append(points, [2]float64{node.Lon, node.Lat})
+			}
+		}
+		if len(points) >= 2 {
+			geometry = append(geometry, points)
+		}
+	}
+	return geometry
+}
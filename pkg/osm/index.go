@@ -0,0 +1,114 @@
+package osm
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// defaultIndexCellSize is the grid cell size in degrees, roughly 1km of latitude
+	defaultIndexCellSize = 0.01
+
+	// maxIndexCellsPerWay limits how many cells a single way is added to. Larger
+	// ways, such as long boundaries, are kept in a separate list checked on every query.
+	maxIndexCellsPerWay = 256
+)
+
+// WayIndex is a uniform grid index over way bounding boxes, used to find the
+// ways near a GPX track without scanning every way in the region. It is saved
+// as part of the binary cache.
+type WayIndex struct {
+	CellSize float64
+	Cells    map[int64][]int64 // cell key -> way IDs
+	Oversize []int64           // ways spanning more than maxIndexCellsPerWay cells
+}
+
+// cellRange returns the grid rows and columns covered by a bounding box
+func (idx *WayIndex) cellRange(bbox [4]float64) (minRow, minCol, maxRow, maxCol int64) {
+	minRow = int64(math.Floor(bbox[0] / idx.CellSize))
+	minCol = int64(math.Floor(bbox[1] / idx.CellSize))
+	maxRow = int64(math.Floor(bbox[2] / idx.CellSize))
+	maxCol = int64(math.Floor(bbox[3] / idx.CellSize))
+	return minRow, minCol, maxRow, maxCol
+}
+
+// cellKey combines a grid row and column into a single map key
+func cellKey(row, col int64) int64 {
+	return row<<32 | (col & 0xffffffff)
+}
+
+// BuildWayIndex builds the spatial index over all ways and stores it on the OSM data
+func (d *OSMData) BuildWayIndex() {
+	idx := &WayIndex{
+		CellSize: defaultIndexCellSize,
+		Cells:    make(map[int64][]int64),
+	}
+
+	// Add ways in ID order so each cell's list is sorted
+	ids := make([]int64, 0, len(d.Ways))
+	for id, way := range d.Ways {
+		if len(way.Nodes) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		minRow, minCol, maxRow, maxCol := idx.cellRange(d.Ways[id].BBox)
+		if (maxRow-minRow+1)*(maxCol-minCol+1) > maxIndexCellsPerWay {
+			idx.Oversize = append(idx.Oversize, id)
+			continue
+		}
+		for row := minRow; row <= maxRow; row++ {
+			for col := minCol; col <= maxCol; col++ {
+				key := cellKey(row, col)
+				idx.Cells[key] = append(idx.Cells[key], id)
+			}
+		}
+	}
+
+	d.WayIndex = idx
+}
+
+// QueryBBox returns the ways whose bounding boxes overlap the given bounding box,
+// sorted by way ID. If no index has been built, every way is checked.
+func (d *OSMData) QueryBBox(bbox [4]float64) []OSMWay {
+	var ways []OSMWay
+
+	if d.WayIndex == nil {
+		for _, way := range d.Ways {
+			if len(way.Nodes) > 0 && Overlaps(way.BBox, bbox) {
+				ways = append(ways, way)
+			}
+		}
+		sort.Slice(ways, func(i, j int) bool { return ways[i].ID < ways[j].ID })
+		return ways
+	}
+
+	idx := d.WayIndex
+	seen := make(map[int64]bool)
+	check := func(id int64) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		if way, exists := d.Ways[id]; exists && Overlaps(way.BBox, bbox) {
+			ways = append(ways, way)
+		}
+	}
+
+	minRow, minCol, maxRow, maxCol := idx.cellRange(bbox)
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			for _, id := range idx.Cells[cellKey(row, col)] {
+				check(id)
+			}
+		}
+	}
+	for _, id := range idx.Oversize {
+		check(id)
+	}
+
+	sort.Slice(ways, func(i, j int) bool { return ways[i].ID < ways[j].ID })
+	return ways
+}
@@ -1,19 +1,37 @@
 package osm
 
 import (
-	"encoding/gob"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"strconv"
+	"sync"
 )
 
 // OSM XML data structures
 type OSMData struct {
-	Nodes map[int64]OSMNode
-	Ways  map[int64]OSMWay
+	Nodes     map[int64]OSMNode
+	Ways      map[int64]OSMWay
+	Relations map[int64]OSMRelation
+	WayIndex  *WayIndex
+	Parks     []Park // smallest first
+
+	// endpoints and routeWays are built on first use, and are not saved to the binary cache
+	endpointsOnce sync.Once
+	endpoints     map[int64][]int64
+	routeWaysOnce sync.Once
+	routeWays     map[int64]bool
+
+	// checksum is the SHA-256 of the data in the binary cache, set when it is saved or loaded
+	checksum string
+}
+
+// Checksum returns the hex-encoded SHA-256 of the data as saved in the binary cache, which
+// identifies the OSM data across runs. It is empty if the data was never cached.
+func (d *OSMData) Checksum() string {
+	return d.checksum
 }
 
 type OSMNode struct {
@@ -30,11 +48,28 @@ type OSMWay struct {
 	BBox  [4]float64 // min_lat, min_lon, max_lat, max_lon
 }
 
+// OSMRelation groups ways (and other members) into a single logical feature,
+// such as a route=hiking relation for a trail split into many ways
+type OSMRelation struct {
+	ID      int64
+	Members []OSMMember
+	Tags    map[string]string
+	BBox    [4]float64 // min_lat, min_lon, max_lat, max_lon
+}
+
+// OSMMember is a single member of a relation, in the order given by the relation
+type OSMMember struct {
+	Type string // node, way or relation
+	Ref  int64
+	Role string
+}
+
 // XML parsing structures
 type OSM struct {
-	XMLName xml.Name `xml:"osm"`
-	Nodes   []Node   `xml:"node"`
-	Ways    []Way    `xml:"way"`
+	XMLName   xml.Name   `xml:"osm"`
+	Nodes     []Node     `xml:"node"`
+	Ways      []Way      `xml:"way"`
+	Relations []Relation `xml:"relation"`
 }
 
 type Node struct {
@@ -50,48 +85,73 @@ type Way struct {
 	Tags     []Tag     `xml:"tag"`
 }
 
+type Relation struct {
+	ID      string   `xml:"id,attr"`
+	Members []Member `xml:"member"`
+	Tags    []Tag    `xml:"tag"`
+}
+
 type NodeRef struct {
 	Ref string `xml:"ref,attr"`
 }
 
+type Member struct {
+	Type string `xml:"type,attr"`
+	Ref  string `xml:"ref,attr"`
+	Role string `xml:"role,attr"`
+}
+
 type Tag struct {
 	Key   string `xml:"k,attr"`
 	Value string `xml:"v,attr"`
 }
 
-// Trail represents a trail from the OSM data
+// Trail represents a trail from the OSM data, either a route relation or a
+// group of same-named ways stitched together, along with its ordered polylines
 type Trail struct {
-	ID     int64
-	Name   string
-	Type   string
-	WayIDs []int64
+	ID        int64
+	Name      string
+	Type      string
+	WayIDs    []int64
+	Relation  bool
+	Polylines [][]int64 // ordered node IDs
 }
 
-// loadOSMData loads OSM data, first checking for a cached binary version
-func LoadOSMData(osmFilePath string, forceReload bool) (*OSMData, error) {
+// LoadOSMData loads OSM data from an XML or PBF file, first checking for a cached binary version.
+// Features not accepted by the filter are dropped before the data is cached.
+func LoadOSMData(osmFilePath string, forceReload bool, filter TagFilter) (*OSMData, error) {
 	// Define binary cache file path based on the OSM file path
-	binaryPath := osmFilePath + ".bin"
+	binaryPath := CachePath(osmFilePath)
 
 	// Check if we can use the cached binary version
 	if !forceReload {
-		osmData, err := tryLoadBinary(osmFilePath, binaryPath)
+		osmData, _, err := tryLoadBinary(osmFilePath, binaryPath, filter)
 		if err == nil {
 			fmt.Println("Loaded OSM data from binary cache.")
 			return osmData, nil
 		}
-		fmt.Printf("Could not use binary cache: %v\n", err)
+		fmt.Printf("Could not use binary cache, rebuilding it: %v\n", err)
 	}
 
-	// If binary loading fails or is forced to reload, load from XML
-	fmt.Println("Parsing OSM XML file...")
-	osmData, err := loadOSMFile(osmFilePath)
+	// If binary loading fails or is forced to reload, load from XML or PBF,
+	// keeping only trail-relevant features
+	osmData, err := loadOSMSourceFile(osmFilePath, filter)
 	if err != nil {
 		return nil, err
 	}
+	fmt.Printf("Kept %d nodes, %d ways and %d relations matching tag filter %s\n",
+		len(osmData.Nodes), len(osmData.Ways), len(osmData.Relations), filter)
+
+	// Index ways by location, so GPX tracks only need to check nearby ways
+	osmData.BuildWayIndex()
+
+	// Find park boundaries, so matched trails can be assigned to parks
+	osmData.BuildParks()
+	fmt.Printf("Found %d named parks\n", len(osmData.Parks))
 
 	// Save to binary for future use
 	fmt.Println("Saving parsed data to binary cache...")
-	err = saveToBinary(osmData, binaryPath)
+	err = saveToBinary(osmData, osmFilePath, binaryPath, filter)
 	if err != nil {
 		fmt.Printf("Warning: Failed to save binary cache: %v\n", err)
 	}
@@ -99,81 +159,74 @@ func LoadOSMData(osmFilePath string, forceReload bool) (*OSMData, error) {
 	return osmData, nil
 }
 
-// tryLoadBinary attempts to load OSM data from the binary cache file
-func tryLoadBinary(osmFilePath, binaryPath string) (*OSMData, error) {
-	// Check if binary file exists
-	binaryInfo, err := os.Stat(binaryPath)
-	if err != nil {
-		return nil, fmt.Errorf("binary cache doesn't exist")
+// loadOSMSourceFile loads an OSM XML or PBF file, depending on its extension or contents,
+// keeping only features accepted by the filter
+func loadOSMSourceFile(osmFilePath string, filter TagFilter) (*OSMData, error) {
+	if isPBFFile(osmFilePath) {
+		fmt.Println("Parsing OSM PBF file...")
+		return loadPBFFile(osmFilePath, filter)
 	}
 
-	// Check if XML file exists and get its modification time
-	xmlInfo, err := os.Stat(osmFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("can't access original XML file: %w", err)
-	}
+	fmt.Println("Parsing OSM XML file...")
+	return loadOSMFile(osmFilePath, filter)
+}
 
-	// If XML is newer than binary, binary is outdated
-	if xmlInfo.ModTime().After(binaryInfo.ModTime()) {
-		return nil, fmt.Errorf("binary cache is outdated")
-	}
+// decodeFunc decodes the features of an OSM file kept by the decode filter into the OSM data
+type decodeFunc func(filePath string, osmData *OSMData, decode *decodeFilter) error
 
-	// Load the binary file
-	fmt.Println("Loading OSM map data from binary cache...")
-	file, err := os.Open(binaryPath) // #nosec G304
-	if err != nil {
-		return nil, fmt.Errorf("error opening binary file: %w", err)
+// loadFiltered decodes an OSM file in every pass the filter needs, see decodeFilter
+func loadFiltered(filePath string, filter TagFilter, decodeFile decodeFunc) (*OSMData, error) {
+	osmData := &OSMData{
+		Nodes:     make(map[int64]OSMNode),
+		Ways:      make(map[int64]OSMWay),
+		Relations: make(map[int64]OSMRelation),
 	}
-	defer file.Close()
 
-	// Decode the gob data
-	decoder := gob.NewDecoder(file)
-	var osmData OSMData
-	err = decoder.Decode(&osmData)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding binary data: %w", err)
+	decode := newDecodeFilter(filter)
+	for _, pass := range decode.passes() {
+		decode.pass = pass
+		if err := decodeFile(filePath, osmData, decode); err != nil {
+			return nil, err
+		}
 	}
 
-	return &osmData, nil
-}
-
-// saveToBinary saves the OSM data to a binary file using gob encoding
-func saveToBinary(osmData *OSMData, binaryPath string) error {
-	file, err := os.Create(binaryPath) // #nosec G304
-	if err != nil {
-		return fmt.Errorf("error creating binary file: %w", err)
+	// Nodes are decoded last when filtering, and PBF files don't guarantee nodes
+	// come before ways, or ways before relations, so bounding boxes are
+	// calculated once everything is loaded
+	for id, way := range osmData.Ways {
+		if len(way.Nodes) > 0 {
+			way.BBox = CalculateWayBBox(way, osmData.Nodes)
+			osmData.Ways[id] = way
+		}
 	}
-	defer file.Close()
-
-	// Encode the data
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(osmData)
-	if err != nil {
-		return fmt.Errorf("error encoding data: %w", err)
+	for id, relation := range osmData.Relations {
+		relation.BBox = CalculateRelationBBox(relation, osmData.Ways)
+		osmData.Relations[id] = relation
 	}
 
-	return nil
+	return osmData, nil
 }
 
-// loadOSMFile loads and parses an OSM XML file
-func loadOSMFile(filePath string) (*OSMData, error) {
+// loadOSMFile loads and parses an OSM XML file, keeping only features accepted by the filter
+func loadOSMFile(filePath string, filter TagFilter) (*OSMData, error) {
+	return loadFiltered(filePath, filter, decodeOSMFile)
+}
+
+// decodeOSMFile decodes the features of an OSM XML file kept by the decode filter
+func decodeOSMFile(filePath string, osmData *OSMData, decode *decodeFilter) error {
 	file, err := os.Open(filePath) // #nosec G304
 	if err != nil {
-		return nil, fmt.Errorf("error opening OSM file: %w", err)
+		return fmt.Errorf("error opening OSM file: %w", err)
 	}
 	defer file.Close()
 
-	osmData := &OSMData{
-		Nodes: make(map[int64]OSMNode),
-		Ways:  make(map[int64]OSMWay),
-	}
-
 	decoder := xml.NewDecoder(file)
 
-	// Temporary variables to store current node/way being processed
+	// Temporary variables to store current node/way/relation being processed
 	var currentNode OSMNode
 	var currentWay OSMWay
-	var inNode, inWay bool
+	var currentRelation OSMRelation
+	var inNode, inWay, inRelation bool
 
 	for {
 		token, err := decoder.Token()
@@ -181,16 +234,24 @@ func loadOSMFile(filePath string) (*OSMData, error) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error parsing XML: %w", err)
+			return fmt.Errorf("error parsing XML: %w", err)
 		}
 
 		switch se := token.(type) {
 		case xml.StartElement:
 			switch se.Name.Local {
 			case "node":
+				if !decode.wantsNodes() {
+					if err := decoder.Skip(); err != nil {
+						return fmt.Errorf("error parsing XML: %w", err)
+					}
+					continue
+				}
 				inNode = true
 				inWay = false
-				currentNode = OSMNode{Tags: make(map[string]string)}
+				inRelation = false
+				// Most nodes are untagged, so their tag map is only made once a tag is found
+				currentNode = OSMNode{}
 
 				// Parse node attributes
 				for _, attr := range se.Attr {
@@ -211,8 +272,15 @@ func loadOSMFile(filePath string) (*OSMData, error) {
 				}
 
 			case "way":
+				if !decode.wantsWays() {
+					if err := decoder.Skip(); err != nil {
+						return fmt.Errorf("error parsing XML: %w", err)
+					}
+					continue
+				}
 				inNode = false
 				inWay = true
+				inRelation = false
 				currentWay = OSMWay{
 					Nodes: []int64{},
 					Tags:  make(map[string]string),
@@ -227,6 +295,48 @@ func loadOSMFile(filePath string) (*OSMData, error) {
 					}
 				}
 
+			case "relation":
+				if !decode.wantsRelations() {
+					if err := decoder.Skip(); err != nil {
+						return fmt.Errorf("error parsing XML: %w", err)
+					}
+					continue
+				}
+				inNode = false
+				inWay = false
+				inRelation = true
+				currentRelation = OSMRelation{
+					Members: []OSMMember{},
+					Tags:    make(map[string]string),
+				}
+
+				// Parse relation attributes
+				for _, attr := range se.Attr {
+					if attr.Name.Local == "id" {
+						if id, err := strconv.ParseInt(attr.Value, 10, 64); err == nil {
+							currentRelation.ID = id
+						}
+					}
+				}
+
+			case "member":
+				if inRelation {
+					var member OSMMember
+					for _, attr := range se.Attr {
+						switch attr.Name.Local {
+						case "type":
+							member.Type = attr.Value
+						case "ref":
+							if ref, err := strconv.ParseInt(attr.Value, 10, 64); err == nil {
+								member.Ref = ref
+							}
+						case "role":
+							member.Role = attr.Value
+						}
+					}
+					currentRelation.Members = append(currentRelation.Members, member)
+				}
+
 			case "nd":
 				if inWay {
 					for _, attr := range se.Attr {
@@ -250,9 +360,14 @@ func loadOSMFile(filePath string) (*OSMData, error) {
 
 				if key != "" {
 					if inNode {
+						if currentNode.Tags == nil {
+							currentNode.Tags = make(map[string]string)
+						}
 						currentNode.Tags[key] = value
 					} else if inWay {
 						currentWay.Tags[key] = value
+					} else if inRelation {
+						currentRelation.Tags[key] = value
 					}
 				}
 			}
@@ -260,21 +375,27 @@ func loadOSMFile(filePath string) (*OSMData, error) {
 		case xml.EndElement:
 			switch se.Name.Local {
 			case "node":
-				osmData.Nodes[currentNode.ID] = currentNode
+				if inNode && decode.keepNode(currentNode) {
+					osmData.Nodes[currentNode.ID] = currentNode
+				}
 				inNode = false
 
 			case "way":
-				// Calculate bounding box for the way
-				if len(currentWay.Nodes) > 0 {
-					currentWay.BBox = CalculateWayBBox(currentWay, osmData.Nodes)
+				if inWay && decode.keepWay(currentWay) {
+					osmData.Ways[currentWay.ID] = currentWay
 				}
-				osmData.Ways[currentWay.ID] = currentWay
 				inWay = false
+
+			case "relation":
+				if inRelation && decode.keepRelation(currentRelation) {
+					osmData.Relations[currentRelation.ID] = currentRelation
+				}
+				inRelation = false
 			}
 		}
 	}
 
-	return osmData, nil
+	return nil
 }
 
 // calculateWayBBox calculates the bounding box for a way based on its nodes
@@ -298,6 +419,49 @@ func CalculateWayBBox(way OSMWay, nodes map[int64]OSMNode) [4]float64 {
 	return [4]float64{minLat, minLon, maxLat, maxLon}
 }
 
+// CalculateRelationBBox calculates the bounding box for a relation based on its member ways
+func CalculateRelationBBox(relation OSMRelation, ways map[int64]OSMWay) [4]float64 {
+	minLat, maxLat := 90.0, -90.0
+	minLon, maxLon := 180.0, -180.0
+	found := false
+
+	for _, wayID := range relation.WayIDs() {
+		if way, exists := ways[wayID]; exists && len(way.Nodes) > 0 {
+			minLat = math.Min(minLat, way.BBox[0])
+			minLon = math.Min(minLon, way.BBox[1])
+			maxLat = math.Max(maxLat, way.BBox[2])
+			maxLon = math.Max(maxLon, way.BBox[3])
+			found = true
+		}
+	}
+
+	if !found {
+		return [4]float64{0, 0, 0, 0}
+	}
+
+	return [4]float64{minLat, minLon, maxLat, maxLon}
+}
+
+// WayIDs returns the IDs of the relation's way members, in relation order
+func (r OSMRelation) WayIDs() []int64 {
+	var wayIDs []int64
+	for _, member := range r.Members {
+		if member.Type == "way" {
+			wayIDs = append(wayIDs, member.Ref)
+		}
+	}
+	return wayIDs
+}
+
+// IsHikingRoute checks if the relation is a hiking or foot route, named or not
+func IsHikingRoute(relation OSMRelation) bool {
+	if relation.Tags["type"] != "route" {
+		return false
+	}
+	route := relation.Tags["route"]
+	return route == "hiking" || route == "foot"
+}
+
 // overlaps checks if two bounding boxes overlap
 func Overlaps(box1, box2 [4]float64) bool {
 	// box format: [minLat, minLon, maxLat, maxLon]
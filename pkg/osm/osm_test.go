@@ -0,0 +1,456 @@
+package osm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOSMFile_Relations(t *testing.T) {
+	osmData, err := loadOSMFile("testdata/wildwood.osm", nil)
+	if err != nil {
+		t.Fatalf("loadOSMFile returned error: %v", err)
+	}
+
+	if len(osmData.Nodes) != 4 || len(osmData.Ways) != 2 || len(osmData.Relations) != 1 {
+		t.Fatalf("unexpected counts: %d nodes, %d ways, %d relations", len(osmData.Nodes), len(osmData.Ways), len(osmData.Relations))
+	}
+
+	relation := osmData.Relations[100]
+	if !IsHikingRoute(relation) {
+		t.Errorf("expected relation 100 to be a hiking route, tags: %v", relation.Tags)
+	}
+
+	if len(relation.Members) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(relation.Members))
+	}
+	if relation.Members[1].Role != "forward" || relation.Members[2].Type != "node" {
+		t.Errorf("unexpected members: %+v", relation.Members)
+	}
+
+	wayIDs := relation.WayIDs()
+	if len(wayIDs) != 2 || wayIDs[0] != 10 || wayIDs[1] != 11 {
+		t.Errorf("unexpected way IDs: %v", wayIDs)
+	}
+
+	expectedBBox := [4]float64{45.5400, -122.7230, 45.5430, -122.7200}
+	if relation.BBox != expectedBBox {
+		t.Errorf("unexpected relation bbox: got %v, expected %v", relation.BBox, expectedBBox)
+	}
+}
+
+func TestStitchWays(t *testing.T) {
+	named := func(id int64, name string, nodes ...int64) OSMWay {
+		return OSMWay{ID: id, Nodes: nodes, Tags: map[string]string{"highway": "path", "name": name}}
+	}
+	osmData := &OSMData{
+		Ways: map[int64]OSMWay{
+			30: named(30, "Leif Erikson Drive", 1, 2),
+			20: named(20, "Leif Erikson Drive", 3, 2),
+			40: named(40, "Leif Erikson Drive", 3, 4),
+			50: named(50, "Firelane 1", 4, 5),
+		},
+	}
+	all := func(OSMWay) bool { return true }
+
+	trails := osmData.StitchWays([]int64{40, 30}, all)
+	if len(trails) != 1 {
+		t.Fatalf("expected 1 stitched trail, got %d: %+v", len(trails), trails)
+	}
+
+	trail := trails[0]
+	if trail.ID != 20 {
+		t.Errorf("expected merged ID to be lowest way ID 20, got %d", trail.ID)
+	}
+	if len(trail.WayIDs) != 3 {
+		t.Errorf("expected 3 ways, got %v", trail.WayIDs)
+	}
+	if len(trail.Polylines) != 1 {
+		t.Fatalf("expected 1 polyline, got %v", trail.Polylines)
+	}
+
+	polyline := fmt.Sprint(trail.Polylines[0])
+	if polyline != "[1 2 3 4]" && polyline != "[4 3 2 1]" {
+		t.Errorf("unexpected polyline order: %v", polyline)
+	}
+
+	// Excluded ways split the trail
+	trails = osmData.StitchWays([]int64{30}, func(way OSMWay) bool { return way.ID != 20 })
+	if len(trails) != 1 || len(trails[0].WayIDs) != 1 || trails[0].ID != 30 {
+		t.Errorf("expected way 30 alone, got %+v", trails)
+	}
+}
+
+func TestLoadPBFFile_MatchesXML(t *testing.T) {
+	xmlData, err := loadOSMFile("testdata/wildwood.osm", nil)
+	if err != nil {
+		t.Fatalf("loadOSMFile returned error: %v", err)
+	}
+	pbfData, err := loadPBFFile("testdata/wildwood.osm.pbf", nil)
+	if err != nil {
+		t.Fatalf("loadPBFFile returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(xmlData.Nodes, pbfData.Nodes) {
+		t.Errorf("nodes differ:\nxml: %+v\npbf: %+v", xmlData.Nodes, pbfData.Nodes)
+	}
+	if !reflect.DeepEqual(xmlData.Ways, pbfData.Ways) {
+		t.Errorf("ways differ:\nxml: %+v\npbf: %+v", xmlData.Ways, pbfData.Ways)
+	}
+	if !reflect.DeepEqual(xmlData.Relations, pbfData.Relations) {
+		t.Errorf("relations differ:\nxml: %+v\npbf: %+v", xmlData.Relations, pbfData.Relations)
+	}
+}
+
+func TestIsPBFFile(t *testing.T) {
+	if !isPBFFile("testdata/wildwood.osm.pbf") {
+		t.Error("expected .osm.pbf file to be detected as PBF")
+	}
+	if isPBFFile("testdata/wildwood.osm") {
+		t.Error("expected .osm XML file not to be detected as PBF")
+	}
+
+	// Detection falls back to the file contents when the extension is unhelpful
+	data, err := os.ReadFile("testdata/wildwood.osm.pbf")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	renamed := filepath.Join(t.TempDir(), "wildwood.dat")
+	if err := os.WriteFile(renamed, data, 0600); err != nil {
+		t.Fatalf("failed to write fixture copy: %v", err)
+	}
+	if !isPBFFile(renamed) {
+		t.Error("expected PBF file to be detected by its magic bytes")
+	}
+}
+
+func TestLoadPBFFile_Truncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/wildwood.osm.pbf")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.osm.pbf")
+	if err := os.WriteFile(truncated, data[:len(data)-20], 0600); err != nil {
+		t.Fatalf("failed to write truncated fixture: %v", err)
+	}
+	if _, err := loadPBFFile(truncated, nil); err == nil {
+		t.Error("expected error loading truncated PBF file")
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	filter, err := ParseTagFilter("highway=path|footway, leisure=park,route")
+	if err != nil {
+		t.Fatalf("ParseTagFilter returned error: %v", err)
+	}
+	if got := filter.String(); got != "highway=footway|path,leisure=park,route" {
+		t.Errorf("unexpected filter: %s", got)
+	}
+
+	if filter, _ := ParseTagFilter(""); filter.String() != DefaultTagFilter.String() {
+		t.Errorf("expected empty input to give the default filter, got %s", filter)
+	}
+	if filter, _ := ParseTagFilter("*"); filter != nil {
+		t.Errorf("expected \"*\" to give a nil filter, got %s", filter)
+	}
+	if _, err := ParseTagFilter("=path"); err == nil {
+		t.Error("expected error for entry without key")
+	}
+	if _, err := ParseTagFilter("highway="); err == nil {
+		t.Error("expected error for entry without values")
+	}
+}
+
+func TestLoadOSMFile_TagFilter(t *testing.T) {
+	osmFile := filepath.Join(t.TempDir(), "filter.osm")
+	err := os.WriteFile(osmFile, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+  <node id="1" lat="45.1" lon="-122.1"/>
+  <node id="2" lat="45.2" lon="-122.2"/>
+  <node id="3" lat="45.3" lon="-122.3"/>
+  <node id="4" lat="45.4" lon="-122.4"/>
+  <node id="5" lat="45.5" lon="-122.5"/>
+  <way id="10"><nd ref="1"/><nd ref="2"/><tag k="highway" v="path"/></way>
+  <way id="11"><nd ref="3"/><nd ref="4"/><tag k="building" v="yes"/></way>
+  <way id="12"><nd ref="4"/><nd ref="5"/></way>
+  <relation id="100">
+    <member type="way" ref="12" role="outer"/>
+    <tag k="type" v="multipolygon"/><tag k="leisure" v="park"/>
+  </relation>
+  <relation id="101">
+    <member type="way" ref="11" role="outer"/>
+    <tag k="type" v="multipolygon"/><tag k="building" v="yes"/>
+  </relation>
+</osm>`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	osmData, err := loadOSMFile(osmFile, DefaultTagFilter)
+	if err != nil {
+		t.Fatalf("loadOSMFile returned error: %v", err)
+	}
+
+	if _, ok := osmData.Ways[11]; ok {
+		t.Error("expected building way to be dropped")
+	}
+	if _, ok := osmData.Ways[12]; !ok {
+		t.Error("expected untagged park boundary member way to be kept")
+	}
+	if _, ok := osmData.Relations[101]; ok {
+		t.Error("expected building relation to be dropped")
+	}
+	if _, ok := osmData.Nodes[3]; ok {
+		t.Error("expected orphaned node 3 to be dropped")
+	}
+	if len(osmData.Nodes) != 4 || len(osmData.Ways) != 2 || len(osmData.Relations) != 1 {
+		t.Errorf("unexpected counts: %d nodes, %d ways, %d relations", len(osmData.Nodes), len(osmData.Ways), len(osmData.Relations))
+	}
+	if osmData.Nodes[1].Tags != nil {
+		t.Errorf("expected untagged node to have no tag map, got %v", osmData.Nodes[1].Tags)
+	}
+
+	expectedBBox := [4]float64{45.4, -122.5, 45.5, -122.4}
+	if osmData.Relations[100].BBox != expectedBBox {
+		t.Errorf("unexpected relation bbox: got %v, expected %v", osmData.Relations[100].BBox, expectedBBox)
+	}
+}
+
+func TestLoadPBFFile_TagFilter(t *testing.T) {
+	// Only the route relation matches, so its member ways and their nodes are kept through it
+	filter := TagFilter{"route": {"hiking"}}
+	xmlData, err := loadOSMFile("testdata/wildwood.osm", filter)
+	if err != nil {
+		t.Fatalf("loadOSMFile returned error: %v", err)
+	}
+	pbfData, err := loadPBFFile("testdata/wildwood.osm.pbf", filter)
+	if err != nil {
+		t.Fatalf("loadPBFFile returned error: %v", err)
+	}
+
+	if len(pbfData.Nodes) != 4 || len(pbfData.Ways) != 2 || len(pbfData.Relations) != 1 {
+		t.Errorf("unexpected counts: %d nodes, %d ways, %d relations", len(pbfData.Nodes), len(pbfData.Ways), len(pbfData.Relations))
+	}
+	if !reflect.DeepEqual(xmlData, pbfData) {
+		t.Errorf("filtered data differs:\nxml: %+v\npbf: %+v", xmlData, pbfData)
+	}
+
+	pbfData, err = loadPBFFile("testdata/wildwood.osm.pbf", TagFilter{"leisure": {"park"}})
+	if err != nil {
+		t.Fatalf("loadPBFFile returned error: %v", err)
+	}
+	if len(pbfData.Nodes) != 0 || len(pbfData.Ways) != 0 || len(pbfData.Relations) != 0 {
+		t.Errorf("expected nothing to match, got %d nodes, %d ways, %d relations", len(pbfData.Nodes), len(pbfData.Ways), len(pbfData.Relations))
+	}
+}
+
+func TestQueryBBox(t *testing.T) {
+	osmData, err := loadOSMFile("testdata/wildwood.osm", nil)
+	if err != nil {
+		t.Fatalf("loadOSMFile returned error: %v", err)
+	}
+	// A long way spanning many grid cells
+	osmData.Ways[12] = OSMWay{ID: 12, Nodes: []int64{1, 4}, BBox: [4]float64{44.0, -124.0, 46.0, -122.0}}
+
+	queries := map[string][4]float64{
+		"first way only": {45.5399, -122.7211, 45.5405, -122.7199},
+		"both ways":      {45.5405, -122.7225, 45.5415, -122.7205},
+		"no trail ways":  {45.6, -122.6, 45.7, -122.5},
+	}
+
+	for name, bbox := range queries {
+		unindexed := osmData.QueryBBox(bbox)
+		osmData.BuildWayIndex()
+		indexed := osmData.QueryBBox(bbox)
+		osmData.WayIndex = nil
+
+		if !reflect.DeepEqual(unindexed, indexed) {
+			t.Errorf("%s: indexed query %v differs from full scan %v", name, wayIDs(indexed), wayIDs(unindexed))
+		}
+	}
+
+	osmData.BuildWayIndex()
+	if got := wayIDs(osmData.QueryBBox(queries["both ways"])); fmt.Sprint(got) != "[10 11 12]" {
+		t.Errorf("unexpected ways for query: %v", got)
+	}
+	if len(osmData.WayIndex.Oversize) != 1 {
+		t.Errorf("expected the long way to be kept out of the grid, got %v", osmData.WayIndex.Oversize)
+	}
+}
+
+func wayIDs(ways []OSMWay) []int64 {
+	var ids []int64
+	for _, way := range ways {
+		ids = append(ids, way.ID)
+	}
+	return ids
+}
+
+func TestBinaryCache(t *testing.T) {
+	source, err := os.ReadFile("testdata/wildwood.osm")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	osmFile := filepath.Join(t.TempDir(), "wildwood.osm")
+	if err := os.WriteFile(osmFile, source, 0600); err != nil {
+		t.Fatalf("failed to write fixture copy: %v", err)
+	}
+
+	loaded, err := LoadOSMData(osmFile, true, DefaultTagFilter)
+	if err != nil {
+		t.Fatalf("LoadOSMData returned error: %v", err)
+	}
+
+	header, err := VerifyCache(osmFile, DefaultTagFilter)
+	if err != nil {
+		t.Fatalf("expected fresh cache to verify, got: %v", err)
+	}
+	if header.FormatVersion != CacheFormatVersion || header.Ways != len(loaded.Ways) {
+		t.Errorf("unexpected cache header: %+v", header)
+	}
+
+	cached, _, err := tryLoadBinary(osmFile, CachePath(osmFile), DefaultTagFilter)
+	if err != nil {
+		t.Fatalf("tryLoadBinary returned error: %v", err)
+	}
+	if !reflect.DeepEqual(cached.Ways, loaded.Ways) || !reflect.DeepEqual(cached.WayIndex, loaded.WayIndex) {
+		t.Error("cached data differs from loaded data")
+	}
+	if loaded.Checksum() == "" || cached.Checksum() != loaded.Checksum() {
+		t.Errorf("expected matching checksums, got %q and %q", loaded.Checksum(), cached.Checksum())
+	}
+
+	// A different filter makes the cache unusable
+	if _, err := VerifyCache(osmFile, nil); err == nil {
+		t.Error("expected cache built with another tag filter to be rejected")
+	}
+
+	// Corrupting the cached data fails the checksum
+	cache, err := os.ReadFile(CachePath(osmFile))
+	if err != nil {
+		t.Fatalf("failed to read cache: %v", err)
+	}
+	cache[len(cache)-2] ^= 0xff
+	if err := os.WriteFile(CachePath(osmFile), cache, 0600); err != nil {
+		t.Fatalf("failed to write corrupted cache: %v", err)
+	}
+	if _, err := VerifyCache(osmFile, DefaultTagFilter); err == nil {
+		t.Error("expected corrupted cache to be rejected")
+	}
+
+	// Changing the source, even without changing its size, makes the cache stale
+	if _, err := LoadOSMData(osmFile, true, DefaultTagFilter); err != nil {
+		t.Fatalf("LoadOSMData returned error: %v", err)
+	}
+	changed := []byte(string(source))
+	copy(changed[len(changed)-20:], "<!-- changed -->")
+	if err := os.WriteFile(osmFile, changed, 0600); err != nil {
+		t.Fatalf("failed to write changed fixture: %v", err)
+	}
+	if _, err := VerifyCache(osmFile, DefaultTagFilter); err == nil {
+		t.Error("expected cache of changed OSM file to be rejected")
+	}
+}
+
+func TestTrailPark(t *testing.T) {
+	// A square protected area, containing a smaller park with a hole cut out of it
+	d := &OSMData{
+		Nodes: map[int64]OSMNode{
+			1: {ID: 1, Lat: 0, Lon: 0}, 2: {ID: 2, Lat: 0, Lon: 10}, 3: {ID: 3, Lat: 10, Lon: 10}, 4: {ID: 4, Lat: 10, Lon: 0},
+			5: {ID: 5, Lat: 1, Lon: 1}, 6: {ID: 6, Lat: 1, Lon: 5}, 7: {ID: 7, Lat: 5, Lon: 5}, 8: {ID: 8, Lat: 5, Lon: 1},
+			9: {ID: 9, Lat: 2, Lon: 2}, 10: {ID: 10, Lat: 2, Lon: 3}, 11: {ID: 11, Lat: 3, Lon: 3}, 12: {ID: 12, Lat: 3, Lon: 2},
+			// trail nodes
+			20: {ID: 20, Lat: 1.5, Lon: 1.5}, 21: {ID: 21, Lat: 4.5, Lon: 4.5},
+			22: {ID: 22, Lat: 2.4, Lon: 2.4}, 23: {ID: 23, Lat: 2.6, Lon: 2.6},
+			24: {ID: 24, Lat: 8, Lon: 8}, 25: {ID: 25, Lat: 20, Lon: 20},
+		},
+		Ways: map[int64]OSMWay{
+			100: {ID: 100, Nodes: []int64{1, 2, 3, 4, 1}, Tags: map[string]string{"boundary": "protected_area", "name": "Big Wilderness"}},
+			// the smaller park's outer ring is split across two ways
+			101: {ID: 101, Nodes: []int64{5, 6, 7}},
+			102: {ID: 102, Nodes: []int64{7, 8, 5}},
+			103: {ID: 103, Nodes: []int64{9, 10, 11, 12, 9}},
+		},
+		Relations: map[int64]OSMRelation{
+			200: {ID: 200, Tags: map[string]string{"type": "multipolygon", "leisure": "park", "name": "Small Park"},
+				Members: []OSMMember{{Type: "way", Ref: 101, Role: "outer"}, {Type: "way", Ref: 102, Role: "outer"}, {Type: "way", Ref: 103, Role: "inner"}}},
+		},
+	}
+	d.BuildParks()
+
+	if len(d.Parks) != 2 || d.Parks[0].Name != "Small Park" {
+		t.Fatalf("expected two parks, smallest first, got %+v", d.Parks)
+	}
+
+	tests := []struct {
+		nodes    []int64
+		expected string
+	}{
+		{[]int64{20, 21}, "Small Park"},
+		{[]int64{22, 23}, "Big Wilderness"}, // in the hole of the smaller park
+		{[]int64{24}, "Big Wilderness"},
+		{[]int64{25}, ""},
+	}
+	for _, tt := range tests {
+		if got := d.TrailPark(Trail{Polylines: [][]int64{tt.nodes}}); got != tt.expected {
+			t.Errorf("TrailPark(%v) = %q, expected %q", tt.nodes, got, tt.expected)
+		}
+	}
+}
+
+func TestTrailGeometry(t *testing.T) {
+	named := func(id int64, name string, nodes ...int64) OSMWay {
+		return OSMWay{ID: id, Nodes: nodes, Tags: map[string]string{"highway": "path", "name": name}}
+	}
+	osmData := &OSMData{
+		Nodes: map[int64]OSMNode{
+			1: {ID: 1, Lat: 45.50, Lon: -122.70}, 2: {ID: 2, Lat: 45.51, Lon: -122.71},
+			3: {ID: 3, Lat: 45.52, Lon: -122.72}, 4: {ID: 4, Lat: 45.53, Lon: -122.73},
+		},
+		Ways: map[int64]OSMWay{
+			10: named(10, "Wildwood Trail", 1, 2),
+			11: named(11, "Wildwood Trail", 2, 3),
+			12: named(12, "Firelane 1", 3, 4),
+		},
+		Relations: map[int64]OSMRelation{
+			20: {ID: 20, Tags: map[string]string{"type": "route", "route": "hiking"},
+				Members: []OSMMember{{Type: "way", Ref: 11}, {Type: "way", Ref: 12}}},
+		},
+	}
+
+	// A way is stitched with the connected ways sharing its name
+	geometry := osmData.TrailGeometry("way", 10)
+	if len(geometry) != 1 || len(geometry[0]) != 3 {
+		t.Fatalf("expected one polyline of 3 points for way 10, got %v", geometry)
+	}
+	if first := geometry[0][0]; first != [2]float64{-122.70, 45.50} && first != [2]float64{-122.72, 45.52} {
+		t.Errorf("expected [lon, lat] points, got %v", first)
+	}
+
+	if geometry := osmData.TrailGeometry("relation", 20); len(geometry) != 1 || len(geometry[0]) != 3 {
+		t.Errorf("expected one polyline of 3 points for relation 20, got %v", geometry)
+	}
+	if geometry := osmData.TrailGeometry("way", 99); geometry != nil {
+		t.Errorf("expected no geometry for a missing way, got %v", geometry)
+	}
+
+	// Ways are stitched as GPX matching stitches them: members of named routes and
+	// named roads are left out
+	osmData = &OSMData{
+		Nodes: osmData.Nodes,
+		Ways: map[int64]OSMWay{
+			10: named(10, "Wildwood Trail", 1, 2),
+			11: named(11, "Wildwood Trail", 2, 3),
+			12: {ID: 12, Nodes: []int64{3, 4}, Tags: map[string]string{"highway": "residential", "name": "Wildwood Trail"}},
+		},
+		Relations: map[int64]OSMRelation{
+			20: {ID: 20, Tags: map[string]string{"type": "route", "route": "hiking", "name": "Wildwood Trail"},
+				Members: []OSMMember{{Type: "way", Ref: 10}}},
+		},
+	}
+	if geometry := osmData.TrailGeometry("way", 11); len(geometry) != 1 || len(geometry[0]) != 2 {
+		t.Errorf("expected way 11 alone, got %v", geometry)
+	}
+}
@@ -0,0 +1,216 @@
+package osm
+
+import (
+	"math"
+	"sort"
+)
+
+// maxParkSamplePoints limits how many of a trail's nodes are checked against park boundaries
+const maxParkSamplePoints = 25
+
+// Park is a named park or protected area, as rings of node IDs. A point is in the
+// park when it is inside an outer ring and not inside an inner ring.
+type Park struct {
+	ID    int64
+	Type  string // way or relation
+	Name  string
+	Outer [][]int64
+	Inner [][]int64
+	BBox  [4]float64
+	Area  float64 // square degrees, used to prefer the smallest of nested parks
+}
+
+// IsParkArea checks if tags describe a park or protected area
+func IsParkArea(tags map[string]string) bool {
+	switch tags["leisure"] {
+	case "park", "nature_reserve":
+		return true
+	}
+	switch tags["boundary"] {
+	case "protected_area", "national_park":
+		return true
+	}
+	return false
+}
+
+// BuildParks finds the named park areas in the OSM data, from closed ways and
+// multipolygon or boundary relations, and stores them sorted by area, smallest first
+func (d *OSMData) BuildParks() {
+	var parks []Park
+
+	for id, way := range d.Ways {
+		if !IsParkArea(way.Tags) || way.Tags["name"] == "" || len(way.Nodes) < 4 || way.Nodes[0] != way.Nodes[len(way.Nodes)-1] {
+			continue
+		}
+		parks = append(parks, Park{ID: id, Type: "way", Name: way.Tags["name"], Outer: [][]int64{way.Nodes}})
+	}
+
+	for id, relation := range d.Relations {
+		relationType := relation.Tags["type"]
+		if relationType != "multipolygon" && relationType != "boundary" {
+			continue
+		}
+		if !IsParkArea(relation.Tags) || relation.Tags["name"] == "" {
+			continue
+		}
+
+		var outer, inner []int64
+		for _, member := range relation.Members {
+			if member.Type != "way" {
+				continue
+			}
+			if member.Role == "inner" {
+				inner = append(inner, member.Ref)
+			} else {
+				outer = append(outer, member.Ref)
+			}
+		}
+		park := Park{ID: id, Type: "relation", Name: relation.Tags["name"], Outer: d.rings(outer), Inner: d.rings(inner)}
+		if len(park.Outer) > 0 {
+			parks = append(parks, park)
+		}
+	}
+
+	for i := range parks {
+		parks[i].BBox, parks[i].Area = d.ringsExtent(parks[i].Outer, parks[i].Inner)
+	}
+
+	// Sort by area so the smallest containing park is found first, then by ID for stable ties
+	sort.Slice(parks, func(i, j int) bool {
+		if parks[i].Area != parks[j].Area {
+			return parks[i].Area < parks[j].Area
+		}
+		return parks[i].ID < parks[j].ID
+	})
+	d.Parks = parks
+}
+
+// rings chains ways into rings, dropping any too short to enclose an area
+func (d *OSMData) rings(wayIDs []int64) [][]int64 {
+	var rings [][]int64
+	for _, ring := range d.ChainWays(wayIDs) {
+		if len(ring) >= 3 {
+			rings = append(rings, ring)
+		}
+	}
+	return rings
+}
+
+// ringsExtent returns the bounding box of outer rings, and their area less the area of inner rings
+func (d *OSMData) ringsExtent(outer, inner [][]int64) ([4]float64, float64) {
+	minLat, maxLat := 90.0, -90.0
+	minLon, maxLon := 180.0, -180.0
+	area := 0.0
+	for _, ring := range outer {
+		for _, nodeID := range ring {
+			if node, exists := d.Nodes[nodeID]; exists {
+				minLat = math.Min(minLat, node.Lat)
+				maxLat = math.Max(maxLat, node.Lat)
+				minLon = math.Min(minLon, node.Lon)
+				maxLon = math.Max(maxLon, node.Lon)
+			}
+		}
+		area += d.ringArea(ring)
+	}
+	for _, ring := range inner {
+		area -= d.ringArea(ring)
+	}
+	return [4]float64{minLat, minLon, maxLat, maxLon}, math.Max(area, 0)
+}
+
+// ringArea returns the area of a ring in square degrees, using the shoelace formula
+func (d *OSMData) ringArea(ring []int64) float64 {
+	sum := 0.0
+	for i := range ring {
+		a, aOK := d.Nodes[ring[i]]
+		b, bOK := d.Nodes[ring[(i+1)%len(ring)]]
+		if aOK && bOK {
+			sum += a.Lon*b.Lat - b.Lon*a.Lat
+		}
+	}
+	return math.Abs(sum) / 2
+}
+
+// ringContains checks if a point is inside a ring, by counting edge crossings of a ray cast east from it
+func (d *OSMData) ringContains(ring []int64, lat, lon float64) bool {
+	inside := false
+	for i := range ring {
+		a, aOK := d.Nodes[ring[i]]
+		b, bOK := d.Nodes[ring[(i+1)%len(ring)]]
+		if !aOK || !bOK {
+			continue
+		}
+		if (a.Lat > lat) != (b.Lat > lat) && lon < a.Lon+(lat-a.Lat)*(b.Lon-a.Lon)/(b.Lat-a.Lat) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// contains checks if a point is inside the park
+func (d *OSMData) contains(park Park, lat, lon float64) bool {
+	if lat < park.BBox[0] || lat > park.BBox[2] || lon < park.BBox[1] || lon > park.BBox[3] {
+		return false
+	}
+	for _, ring := range park.Inner {
+		if d.ringContains(ring, lat, lon) {
+			return false
+		}
+	}
+	for _, ring := range park.Outer {
+		if d.ringContains(ring, lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrailPark returns the name of the park containing most of a trail, or "" if it isn't
+// in any park. Each sampled point of the trail counts towards the smallest park
+// containing it, so a trail in a park within a larger protected area gets the park.
+func (d *OSMData) TrailPark(trail Trail) string {
+	var nodeIDs []int64
+	for _, polyline := range trail.Polylines {
+		nodeIDs = append(nodeIDs, polyline...)
+	}
+	if len(nodeIDs) == 0 || len(d.Parks) == 0 {
+		return ""
+	}
+
+	// Only parks overlapping the trail can contain it
+	var nodes []OSMNode
+	step := max(1, len(nodeIDs)/maxParkSamplePoints)
+	for i := 0; i < len(nodeIDs); i += step {
+		if node, exists := d.Nodes[nodeIDs[i]]; exists {
+			nodes = append(nodes, node)
+		}
+	}
+	bbox := CalculateWayBBox(OSMWay{Nodes: nodeIDs}, d.Nodes)
+	var candidates []Park
+	for _, park := range d.Parks {
+		if Overlaps(park.BBox, bbox) {
+			candidates = append(candidates, park)
+		}
+	}
+
+	votes := make(map[int]int)
+	for _, node := range nodes {
+		for i, park := range candidates {
+			if d.contains(park, node.Lat, node.Lon) {
+				votes[i]++
+				break
+			}
+		}
+	}
+
+	best, bestVotes := -1, 0
+	for i := range candidates {
+		if votes[i] > bestVotes {
+			best, bestVotes = i, votes[i]
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return candidates[best].Name
+}
@@ -0,0 +1,819 @@
+package osm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OSM PBF format, see https://wiki.openstreetmap.org/wiki/PBF_Format
+//
+// A PBF file is a sequence of blobs, each preceded by a 4-byte big-endian
+// length and a BlobHeader. The first blob holds an OSMHeader block, the rest
+// hold OSMData blocks (PrimitiveBlocks) of nodes, ways and relations. All
+// messages are protobuf encoded, and are decoded by hand below.
+
+const (
+	maxBlobHeaderSize = 64 * 1024
+	maxBlobSize       = 32 * 1024 * 1024
+)
+
+// supportedPBFFeatures lists the HeaderBlock required_features which this decoder understands
+var supportedPBFFeatures = map[string]bool{
+	"OsmSchema-V0.6": true,
+	"DenseNodes":     true,
+}
+
+// isPBFFile checks if a file is an OSM PBF file, by extension or by its leading bytes
+func isPBFFile(filePath string) bool {
+	if strings.HasSuffix(strings.ToLower(filepath.Base(filePath)), ".pbf") {
+		return true
+	}
+
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// A PBF file starts with the length of the first BlobHeader, followed by
+	// its type field: tag 0x0A, length 9, "OSMHeader"
+	magic := make([]byte, 15)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic[4:], []byte("\x0a\x09OSMHeader"))
+}
+
+// loadPBFFile loads and parses an OSM PBF file, keeping only features accepted by the filter
+func loadPBFFile(filePath string, filter TagFilter) (*OSMData, error) {
+	return loadFiltered(filePath, filter, decodePBFFile)
+}
+
+// decodePBFFile decodes the features of an OSM PBF file kept by the decode filter
+func decodePBFFile(filePath string, osmData *OSMData, decode *decodeFilter) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error opening OSM file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	seenHeader := false
+	for {
+		blobType, data, err := readPBFBlob(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading PBF blob: %w", err)
+		}
+
+		switch blobType {
+		case "OSMHeader":
+			if err := decodeHeaderBlock(data); err != nil {
+				return err
+			}
+			seenHeader = true
+		case "OSMData":
+			if !seenHeader {
+				return fmt.Errorf("error parsing PBF: OSMData blob before OSMHeader")
+			}
+			if err := decodePrimitiveBlock(data, osmData, decode); err != nil {
+				return fmt.Errorf("error parsing PBF data block: %w", err)
+			}
+		default:
+			// Unknown blob types must be skipped
+			continue
+		}
+	}
+
+	return nil
+}
+
+// readPBFBlob reads the next blob from the file, returning its type and decompressed contents
+func readPBFBlob(reader io.Reader) (string, []byte, error) {
+	var headerSize uint32
+	if err := binary.Read(reader, binary.BigEndian, &headerSize); err != nil {
+		if err == io.EOF {
+			return "", nil, io.EOF
+		}
+		return "", nil, fmt.Errorf("error reading blob header size: %w", err)
+	}
+	if headerSize > maxBlobHeaderSize {
+		return "", nil, fmt.Errorf("blob header too large: %d bytes", headerSize)
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", nil, fmt.Errorf("error reading blob header: %w", err)
+	}
+
+	// BlobHeader: type = 1, indexdata = 2, datasize = 3
+	var blobType string
+	var dataSize uint64
+	msg := protoMessage{buf: header}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return "", nil, err
+		}
+		switch field {
+		case 1:
+			value, err := msg.bytes(wireType)
+			if err != nil {
+				return "", nil, err
+			}
+			blobType = string(value)
+		case 3:
+			if dataSize, err = msg.varint(wireType); err != nil {
+				return "", nil, err
+			}
+		default:
+			if err := msg.skip(wireType); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	if dataSize > maxBlobSize {
+		return "", nil, fmt.Errorf("blob too large: %d bytes", dataSize)
+	}
+
+	blob := make([]byte, dataSize)
+	if _, err := io.ReadFull(reader, blob); err != nil {
+		return "", nil, fmt.Errorf("error reading blob: %w", err)
+	}
+
+	data, err := decodeBlob(blob)
+	if err != nil {
+		return "", nil, err
+	}
+	return blobType, data, nil
+}
+
+// decodeBlob returns the uncompressed contents of a Blob message
+func decodeBlob(blob []byte) ([]byte, error) {
+	// Blob: raw = 1, raw_size = 2, zlib_data = 3, lzma_data = 4, OBSOLETE_bzip2_data = 5, lz4_data = 6, zstd_data = 7
+	var rawSize uint64
+	var raw, zlibData []byte
+	msg := protoMessage{buf: blob}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return nil, err
+		}
+		switch field {
+		case 1:
+			if raw, err = msg.bytes(wireType); err != nil {
+				return nil, err
+			}
+		case 2:
+			if rawSize, err = msg.varint(wireType); err != nil {
+				return nil, err
+			}
+		case 3:
+			if zlibData, err = msg.bytes(wireType); err != nil {
+				return nil, err
+			}
+		case 4, 5, 6, 7:
+			return nil, fmt.Errorf("unsupported blob compression (field %d), only raw and zlib are supported", field)
+		default:
+			if err := msg.skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case raw != nil:
+		return raw, nil
+	case zlibData != nil:
+		if rawSize > maxBlobSize {
+			return nil, fmt.Errorf("blob too large: %d bytes", rawSize)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(zlibData))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing blob: %w", err)
+		}
+		defer zr.Close()
+		data := make([]byte, rawSize)
+		if _, err := io.ReadFull(zr, data); err != nil {
+			return nil, fmt.Errorf("error decompressing blob: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("blob has no data")
+	}
+}
+
+// decodeHeaderBlock checks that the file only requires features this decoder supports
+func decodeHeaderBlock(data []byte) error {
+	// HeaderBlock: bbox = 1, required_features = 4, optional_features = 5, ...
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return err
+		}
+		if field != 4 {
+			if err := msg.skip(wireType); err != nil {
+				return err
+			}
+			continue
+		}
+		feature, err := msg.bytes(wireType)
+		if err != nil {
+			return err
+		}
+		if !supportedPBFFeatures[string(feature)] {
+			return fmt.Errorf("unsupported PBF required feature: %s", feature)
+		}
+	}
+	return nil
+}
+
+// primitiveBlock holds the block-wide values needed to decode its groups
+type primitiveBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+// coordinate converts an encoded latitude or longitude into degrees
+func (b *primitiveBlock) coordinate(offset, value int64) float64 {
+	// Dividing the exact nanodegree value keeps results identical to parsing the decimal text
+	return float64(offset+b.granularity*value) / 1e9
+}
+
+// decodePrimitiveBlock decodes a PrimitiveBlock's features kept by the decode filter into the OSM data
+func decodePrimitiveBlock(data []byte, osmData *OSMData, decode *decodeFilter) error {
+	// PrimitiveBlock: stringtable = 1, primitivegroup = 2, granularity = 17,
+	// date_granularity = 18, lat_offset = 19, lon_offset = 20
+	block := primitiveBlock{granularity: 100}
+	var groups [][]byte
+
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			table, err := msg.bytes(wireType)
+			if err != nil {
+				return err
+			}
+			if block.strings, err = decodeStringTable(table); err != nil {
+				return err
+			}
+		case 2:
+			// Groups are decoded once the granularity and offsets are known
+			group, err := msg.bytes(wireType)
+			if err != nil {
+				return err
+			}
+			groups = append(groups, group)
+		case 17:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return err
+			}
+			block.granularity = int64(value) // #nosec G115
+		case 19:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return err
+			}
+			block.latOffset = int64(value) // #nosec G115
+		case 20:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return err
+			}
+			block.lonOffset = int64(value) // #nosec G115
+		default:
+			if err := msg.skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, group := range groups {
+		if err := block.decodePrimitiveGroup(group, osmData, decode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeStringTable decodes a StringTable message
+func decodeStringTable(data []byte) ([]string, error) {
+	var table []string
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return nil, err
+		}
+		if field != 1 {
+			if err := msg.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		value, err := msg.bytes(wireType)
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, string(value))
+	}
+	return table, nil
+}
+
+// decodePrimitiveGroup decodes a PrimitiveGroup's features kept by the decode filter into the OSM data
+func (b *primitiveBlock) decodePrimitiveGroup(data []byte, osmData *OSMData, decode *decodeFilter) error {
+	// PrimitiveGroup: nodes = 1, dense = 2, ways = 3, relations = 4, changesets = 5
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return err
+		}
+		// Features the current pass doesn't keep are skipped without decoding them
+		wanted := false
+		switch field {
+		case 1, 2:
+			wanted = decode.wantsNodes()
+		case 3:
+			wanted = decode.wantsWays()
+		case 4:
+			wanted = decode.wantsRelations()
+		}
+		if !wanted {
+			if err := msg.skip(wireType); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := msg.bytes(wireType)
+		if err != nil {
+			return err
+		}
+
+		switch field {
+		case 1:
+			node, err := b.decodeNode(value)
+			if err != nil {
+				return err
+			}
+			if decode.keepNode(node) {
+				osmData.Nodes[node.ID] = node
+			}
+		case 2:
+			if err := b.decodeDenseNodes(value, osmData, decode); err != nil {
+				return err
+			}
+		case 3:
+			way, err := b.decodeWay(value)
+			if err != nil {
+				return err
+			}
+			if decode.keepWay(way) {
+				osmData.Ways[way.ID] = way
+			}
+		case 4:
+			relation, err := b.decodeRelation(value)
+			if err != nil {
+				return err
+			}
+			if decode.keepRelation(relation) {
+				osmData.Relations[relation.ID] = relation
+			}
+		}
+	}
+	return nil
+}
+
+// str looks up a string table entry
+func (b *primitiveBlock) str(index uint64) (string, error) {
+	if index >= uint64(len(b.strings)) {
+		return "", fmt.Errorf("string table index %d out of range", index)
+	}
+	return b.strings[index], nil
+}
+
+// tags builds a tag map from parallel key and value string table indexes
+func (b *primitiveBlock) tags(keys, vals []uint64) (map[string]string, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("mismatched tag keys and values")
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		key, err := b.str(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := b.str(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// decodeNode decodes a (non-dense) Node message
+func (b *primitiveBlock) decodeNode(data []byte) (OSMNode, error) {
+	// Node: id = 1 (sint64), keys = 2, vals = 3, info = 4, lat = 8 (sint64), lon = 9 (sint64)
+	var node OSMNode
+	var keys, vals []uint64
+	var lat, lon int64
+
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return node, err
+		}
+		switch field {
+		case 1, 8, 9:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return node, err
+			}
+			switch field {
+			case 1:
+				node.ID = zigzag(value)
+			case 8:
+				lat = zigzag(value)
+			case 9:
+				lon = zigzag(value)
+			}
+		case 2:
+			if keys, err = msg.varints(wireType, keys); err != nil {
+				return node, err
+			}
+		case 3:
+			if vals, err = msg.varints(wireType, vals); err != nil {
+				return node, err
+			}
+		default:
+			if err := msg.skip(wireType); err != nil {
+				return node, err
+			}
+		}
+	}
+
+	// Most nodes are untagged, so they are left without a tag map
+	if len(keys) > 0 || len(vals) > 0 {
+		tags, err := b.tags(keys, vals)
+		if err != nil {
+			return node, err
+		}
+		node.Tags = tags
+	}
+	node.Lat = b.coordinate(b.latOffset, lat)
+	node.Lon = b.coordinate(b.lonOffset, lon)
+	return node, nil
+}
+
+// decodeDenseNodes decodes a DenseNodes message's nodes kept by the decode filter into the OSM data
+func (b *primitiveBlock) decodeDenseNodes(data []byte, osmData *OSMData, decode *decodeFilter) error {
+	// DenseNodes: id = 1, denseinfo = 5, lat = 8, lon = 9, keys_vals = 10
+	// ids, lats and lons are delta coded sint64s
+	var ids, lats, lons, keysVals []uint64
+
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			ids, err = msg.varints(wireType, ids)
+		case 8:
+			lats, err = msg.varints(wireType, lats)
+		case 9:
+			lons, err = msg.varints(wireType, lons)
+		case 10:
+			keysVals, err = msg.varints(wireType, keysVals)
+		default:
+			err = msg.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return fmt.Errorf("mismatched dense node ids and coordinates")
+	}
+
+	var id, lat, lon int64
+	kv := 0
+	for i := range ids {
+		id += zigzag(ids[i])
+		lat += zigzag(lats[i])
+		lon += zigzag(lons[i])
+
+		// Most nodes are untagged, so their tag map is only made once a tag is found
+		node := OSMNode{
+			ID:  id,
+			Lat: b.coordinate(b.latOffset, lat),
+			Lon: b.coordinate(b.lonOffset, lon),
+		}
+
+		// keys_vals holds key, value pairs for each node in turn, each node's
+		// tags ending with a 0. It is empty when no node in the block has tags.
+		for kv < len(keysVals) {
+			if keysVals[kv] == 0 {
+				kv++
+				break
+			}
+			if kv+1 >= len(keysVals) {
+				return fmt.Errorf("truncated dense node tags")
+			}
+			key, err := b.str(keysVals[kv])
+			if err != nil {
+				return err
+			}
+			value, err := b.str(keysVals[kv+1])
+			if err != nil {
+				return err
+			}
+			if node.Tags == nil {
+				node.Tags = make(map[string]string)
+			}
+			node.Tags[key] = value
+			kv += 2
+		}
+
+		if decode.keepNode(node) {
+			osmData.Nodes[node.ID] = node
+		}
+	}
+	return nil
+}
+
+// decodeWay decodes a Way message
+func (b *primitiveBlock) decodeWay(data []byte) (OSMWay, error) {
+	// Way: id = 1 (int64), keys = 2, vals = 3, info = 4, refs = 8 (delta coded sint64)
+	way := OSMWay{Nodes: []int64{}}
+	var keys, vals, refs []uint64
+
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return way, err
+		}
+		switch field {
+		case 1:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return way, err
+			}
+			way.ID = int64(value) // #nosec G115
+		case 2:
+			keys, err = msg.varints(wireType, keys)
+		case 3:
+			vals, err = msg.varints(wireType, vals)
+		case 8:
+			refs, err = msg.varints(wireType, refs)
+		default:
+			err = msg.skip(wireType)
+		}
+		if err != nil {
+			return way, err
+		}
+	}
+
+	tags, err := b.tags(keys, vals)
+	if err != nil {
+		return way, err
+	}
+	way.Tags = tags
+
+	var ref int64
+	for _, delta := range refs {
+		ref += zigzag(delta)
+		way.Nodes = append(way.Nodes, ref)
+	}
+	return way, nil
+}
+
+// decodeRelation decodes a Relation message
+func (b *primitiveBlock) decodeRelation(data []byte) (OSMRelation, error) {
+	// Relation: id = 1 (int64), keys = 2, vals = 3, info = 4, roles_sid = 8,
+	// memids = 9 (delta coded sint64), types = 10 (NODE = 0, WAY = 1, RELATION = 2)
+	relation := OSMRelation{Members: []OSMMember{}}
+	var keys, vals, roles, memids, types []uint64
+
+	msg := protoMessage{buf: data}
+	for msg.more() {
+		field, wireType, err := msg.key()
+		if err != nil {
+			return relation, err
+		}
+		switch field {
+		case 1:
+			value, err := msg.varint(wireType)
+			if err != nil {
+				return relation, err
+			}
+			relation.ID = int64(value) // #nosec G115
+		case 2:
+			keys, err = msg.varints(wireType, keys)
+		case 3:
+			vals, err = msg.varints(wireType, vals)
+		case 8:
+			roles, err = msg.varints(wireType, roles)
+		case 9:
+			memids, err = msg.varints(wireType, memids)
+		case 10:
+			types, err = msg.varints(wireType, types)
+		default:
+			err = msg.skip(wireType)
+		}
+		if err != nil {
+			return relation, err
+		}
+	}
+
+	tags, err := b.tags(keys, vals)
+	if err != nil {
+		return relation, err
+	}
+	relation.Tags = tags
+
+	if len(roles) != len(memids) || len(types) != len(memids) {
+		return relation, fmt.Errorf("mismatched relation member fields")
+	}
+
+	var ref int64
+	for i := range memids {
+		ref += zigzag(memids[i])
+		role, err := b.str(roles[i])
+		if err != nil {
+			return relation, err
+		}
+
+		var memberType string
+		switch types[i] {
+		case 0:
+			memberType = "node"
+		case 1:
+			memberType = "way"
+		case 2:
+			memberType = "relation"
+		default:
+			return relation, fmt.Errorf("unknown relation member type %d", types[i])
+		}
+
+		relation.Members = append(relation.Members, OSMMember{
+			Type: memberType,
+			Ref:  ref,
+			Role: role,
+		})
+	}
+	return relation, nil
+}
+
+// zigzag decodes a protobuf sint64 value
+func zigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1) // #nosec G115
+}
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+	wire32Bit  = 5
+)
+
+// maxVarintSize is the longest encoding of a 64-bit varint
+const maxVarintSize = 10
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// protoMessage is a minimal reader for protobuf encoded messages
+type protoMessage struct {
+	buf []byte
+	pos int
+}
+
+// more reports whether there are unread fields in the message
+func (m *protoMessage) more() bool {
+	return m.pos < len(m.buf)
+}
+
+// readVarint reads a raw varint
+func (m *protoMessage) readVarint() (uint64, error) {
+	var value uint64
+	for i := 0; i < maxVarintSize; i++ {
+		if m.pos >= len(m.buf) {
+			return 0, errTruncated
+		}
+		b := m.buf[m.pos]
+		m.pos++
+		value |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("protobuf varint overflow")
+}
+
+// key reads a field key, returning the field number and wire type
+func (m *protoMessage) key() (int, int, error) {
+	key, err := m.readVarint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(key >> 3), int(key & 7), nil // #nosec G115
+}
+
+// varint reads a varint field value
+func (m *protoMessage) varint(wireType int) (uint64, error) {
+	if wireType != wireVarint {
+		return 0, fmt.Errorf("unexpected protobuf wire type %d, expected varint", wireType)
+	}
+	return m.readVarint()
+}
+
+// bytes reads a length-delimited field value
+func (m *protoMessage) bytes(wireType int) ([]byte, error) {
+	if wireType != wireBytes {
+		return nil, fmt.Errorf("unexpected protobuf wire type %d, expected bytes", wireType)
+	}
+	length, err := m.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(m.buf)-m.pos) {
+		return nil, errTruncated
+	}
+	value := m.buf[m.pos : m.pos+int(length)] // #nosec G115
+	m.pos += int(length)                      // #nosec G115
+	return value, nil
+}
+
+// varints appends a repeated varint field, which may be packed or unpacked
+func (m *protoMessage) varints(wireType int, values []uint64) ([]uint64, error) {
+	if wireType == wireVarint {
+		value, err := m.readVarint()
+		if err != nil {
+			return values, err
+		}
+		return append(values, value), nil
+	}
+
+	packed, err := m.bytes(wireType)
+	if err != nil {
+		return values, err
+	}
+	inner := protoMessage{buf: packed}
+	for inner.more() {
+		value, err := inner.readVarint()
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// skip skips over a field value
+func (m *protoMessage) skip(wireType int) error {
+	var size int
+	switch wireType {
+	case wireVarint:
+		_, err := m.readVarint()
+		return err
+	case wireBytes:
+		_, err := m.bytes(wireType)
+		return err
+	case wire64Bit:
+		size = 8
+	case wire32Bit:
+		size = 4
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+	}
+	if m.pos+size > len(m.buf) {
+		return errTruncated
+	}
+	m.pos += size
+	return nil
+}
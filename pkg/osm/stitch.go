@@ -0,0 +1,226 @@
+package osm
+
+import (
+	"sort"
+)
+
+// buildEndpointIndex maps each way endpoint node to the named ways which start or end there
+func (d *OSMData) buildEndpointIndex() {
+	d.endpoints = make(map[int64][]int64)
+	for id, way := range d.Ways {
+		if len(way.Nodes) == 0 || way.Tags["name"] == "" {
+			continue
+		}
+		first, last := way.Nodes[0], way.Nodes[len(way.Nodes)-1]
+		d.endpoints[first] = append(d.endpoints[first], id)
+		if last != first {
+			d.endpoints[last] = append(d.endpoints[last], id)
+		}
+	}
+
+	// Keep the index order independent of map iteration order
+	for node := range d.endpoints {
+		sort.Slice(d.endpoints[node], func(i, j int) bool {
+			return d.endpoints[node][i] < d.endpoints[node][j]
+		})
+	}
+}
+
+// waysAtEndpoint returns the IDs of named ways which start or end at the given node
+func (d *OSMData) waysAtEndpoint(nodeID int64) []int64 {
+	d.endpointsOnce.Do(d.buildEndpointIndex)
+	return d.endpoints[nodeID]
+}
+
+// IsNamedTrailWay checks if a way is a trail/path based on its tags, and has a name
+func IsNamedTrailWay(way OSMWay) bool {
+	// Check highway tag for trail types
+	switch way.Tags["highway"] {
+	case "path", "footway", "track", "trail", "bridleway", "steps":
+	default:
+		return false
+	}
+
+	// Only include named trails
+	return way.Tags["name"] != ""
+}
+
+// IsNamedHikingRoute checks if a relation is a named hiking route, which is a trail of its own
+func IsNamedHikingRoute(relation OSMRelation) bool {
+	return IsHikingRoute(relation) && relation.Tags["name"] != ""
+}
+
+// buildRouteWays collects the member ways of named hiking routes
+func (d *OSMData) buildRouteWays() {
+	d.routeWays = make(map[int64]bool)
+	for _, relation := range d.Relations {
+		if !IsNamedHikingRoute(relation) {
+			continue
+		}
+		for _, wayID := range relation.WayIDs() {
+			d.routeWays[wayID] = true
+		}
+	}
+}
+
+// IncludeTrailWay checks if a way is stitched into way trails: a named trail way which
+// isn't a member of a named hiking route, since the route is treated as one logical
+// trail. GPX matching and TrailGeometry both stitch ways with it, so trails are drawn
+// from the same ways they were matched as.
+func (d *OSMData) IncludeTrailWay(way OSMWay) bool {
+	d.routeWaysOnce.Do(d.buildRouteWays)
+	return !d.routeWays[way.ID] && IsNamedTrailWay(way)
+}
+
+// StitchWays joins each of the seed ways with every other way sharing its name
+// and connected to it through endpoint nodes, returning one Trail per connected
+// group. Ways are only joined when include returns true for them. The merged
+// Trail ID is the lowest way ID in the group, so it is stable across runs and
+// regardless of which way in the group was used as the seed.
+func (d *OSMData) StitchWays(seeds []int64, include func(OSMWay) bool) []Trail {
+	var trails []Trail
+	visited := make(map[int64]bool)
+
+	for _, seed := range seeds {
+		if visited[seed] {
+			continue
+		}
+		seedWay, exists := d.Ways[seed]
+		if !exists || !include(seedWay) {
+			continue
+		}
+		name := seedWay.Tags["name"]
+
+		// Walk outward from the seed through shared endpoints
+		group := []int64{}
+		queue := []int64{seed}
+		visited[seed] = true
+		for len(queue) > 0 {
+			wayID := queue[0]
+			queue = queue[1:]
+			group = append(group, wayID)
+
+			way := d.Ways[wayID]
+			if len(way.Nodes) == 0 {
+				continue
+			}
+			for _, endpoint := range []int64{way.Nodes[0], way.Nodes[len(way.Nodes)-1]} {
+				for _, neighbourID := range d.waysAtEndpoint(endpoint) {
+					if visited[neighbourID] {
+						continue
+					}
+					neighbour := d.Ways[neighbourID]
+					if neighbour.Tags["name"] != name || !include(neighbour) {
+						continue
+					}
+					visited[neighbourID] = true
+					queue = append(queue, neighbourID)
+				}
+			}
+		}
+
+		sort.Slice(group, func(i, j int) bool { return group[i] < group[j] })
+		first := d.Ways[group[0]]
+
+		trails = append(trails, Trail{
+			ID:        group[0],
+			Name:      name,
+			Type:      first.Tags["highway"],
+			WayIDs:    group,
+			Polylines: d.ChainWays(group),
+		})
+	}
+
+	return trails
+}
+
+// ChainWays orders the given ways into as few polylines as possible by joining
+// them at shared endpoint nodes, reversing ways where needed. Each polyline is
+// returned as an ordered list of node IDs.
+func (d *OSMData) ChainWays(wayIDs []int64) [][]int64 {
+	// Index the endpoints of the given ways only
+	endpointWays := make(map[int64][]int64)
+	var ids []int64
+	for _, wayID := range wayIDs {
+		way, exists := d.Ways[wayID]
+		if !exists || len(way.Nodes) == 0 {
+			continue
+		}
+		ids = append(ids, wayID)
+		first, last := way.Nodes[0], way.Nodes[len(way.Nodes)-1]
+		endpointWays[first] = append(endpointWays[first], wayID)
+		if last != first {
+			endpointWays[last] = append(endpointWays[last], wayID)
+		}
+	}
+
+	used := make(map[int64]bool)
+	var polylines [][]int64
+
+	// nextWay finds an unused way starting or ending at the given node
+	nextWay := func(nodeID int64) (int64, bool) {
+		for _, wayID := range endpointWays[nodeID] {
+			if !used[wayID] {
+				return wayID, true
+			}
+		}
+		return 0, false
+	}
+
+	// extend grows the polyline from its last node for as long as ways connect
+	extend := func(polyline []int64) []int64 {
+		for {
+			tail := polyline[len(polyline)-1]
+			wayID, ok := nextWay(tail)
+			if !ok {
+				return polyline
+			}
+			used[wayID] = true
+			nodes := d.Ways[wayID].Nodes
+			if nodes[0] != tail {
+				nodes = reversed(nodes)
+			}
+			polyline = append(polyline, nodes[1:]...)
+		}
+	}
+
+	// Prefer starting chains at dangling ends, so a simple line is returned as one polyline
+	var starts []int64
+	for _, wayID := range ids {
+		nodes := d.Ways[wayID].Nodes
+		if len(endpointWays[nodes[0]]) == 1 || len(endpointWays[nodes[len(nodes)-1]]) == 1 {
+			starts = append(starts, wayID)
+		}
+	}
+	starts = append(starts, ids...)
+
+	for _, wayID := range starts {
+		if used[wayID] {
+			continue
+		}
+		used[wayID] = true
+		nodes := d.Ways[wayID].Nodes
+		// Start from the dangling end when there is one
+		if len(endpointWays[nodes[0]]) > 1 && len(endpointWays[nodes[len(nodes)-1]]) == 1 {
+			nodes = reversed(nodes)
+		}
+		polyline := extend(append([]int64{}, nodes...))
+
+		// A chain started mid-way may also continue backwards from its head
+		head := reversed(polyline)
+		polyline = reversed(extend(head))
+
+		polylines = append(polylines, polyline)
+	}
+
+	return polylines
+}
+
+// reversed returns a reversed copy of the node list
+func reversed(nodes []int64) []int64 {
+	result := make([]int64, len(nodes))
+	for i, node := range nodes {
+		result[len(nodes)-1-i] = node
+	}
+	return result
+}